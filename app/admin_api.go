@@ -0,0 +1,494 @@
+package main
+
+// Admin HTTP API for managing channels outside Discord. Described in openapi.yaml
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+const (
+	defaultAuditLimit = 50  // Number of audit entries returned if limit is not specified
+	maxAuditLimit     = 500 // Maximum number of audit entries per request
+)
+
+// Channel properties in API format
+type apiChannel struct {
+	ChannelID        string  `json:"channel_id"`
+	GuildID          string  `json:"guild_id"`
+	TimeoutHours     float64 `json:"timeout_hours"`
+	LastActivityDate int64   `json:"last_activity_date"`
+	NextRemoveDate   int64   `json:"next_remove_date"`
+	PausedUntilDate  int64   `json:"paused_until_date"`
+	IsPaused         bool    `json:"is_paused"`
+	IsPrecise        bool    `json:"precise"`
+	IsArchiveThreads bool    `json:"archive_threads"`
+}
+
+// Audit entry in API format
+type apiAuditEntry struct {
+	ID        int64  `json:"id"`
+	Date      int64  `json:"date"`
+	GuildID   string `json:"guild_id"`
+	ChannelID string `json:"channel_id"`
+	Actor     string `json:"actor"`
+	Action    string `json:"action"`
+	Details   string `json:"details"`
+}
+
+// Body of put channel request
+type apiPutChannelRequest struct {
+	TimeoutHours     float64 `json:"timeout_hours"`
+	GuildID          string  `json:"guild_id"`        // Resolved from Discord if not specified
+	IsPrecise        *bool   `json:"precise"`         // Kept if not specified
+	IsArchiveThreads *bool   `json:"archive_threads"` // Kept if not specified
+}
+
+// Thread cleanup in API format
+type apiThreadCleanup struct {
+	ThreadID        string `json:"thread_id"`
+	Status          string `json:"status"`
+	Attempts        int    `json:"attempts"`
+	LastError       string `json:"last_error"`
+	NextAttemptDate int64  `json:"next_attempt_date"`
+	UpdatedDate     int64  `json:"updated_date"`
+}
+
+// Body of purge request
+type apiPurgeRequest struct {
+	OlderThanHours float64 `json:"older_than_hours"` // Channel timeout is used if not specified
+	Limit          int     `json:"limit"`
+	UserID         string  `json:"user_id"`
+}
+
+// Body of pause request
+type apiPauseRequest struct {
+	DurationHours float64 `json:"duration_hours"` // Pause lasts until resume if not specified
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// Start admin API server in background if its address is set in config
+func StartAdminAPI() {
+	address := currentConfig().AdminAPIAddress
+	if address == "" {
+		return
+	}
+
+	go func() {
+		log.Printf("Admin API is listening on %s", address)
+		err := http.ListenAndServe(address, newAdminAPIHandler())
+		if err != nil {
+			log.Fatalf("Admin API server failed: %v", err)
+		}
+	}()
+}
+
+// Create router of admin API. All routes require bearer token
+func newAdminAPIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/channels", apiListChannelsHandler)
+	mux.HandleFunc("GET /api/channels/{channelID}", apiGetChannelHandler)
+	mux.HandleFunc("PUT /api/channels/{channelID}", apiPutChannelHandler)
+	mux.HandleFunc("DELETE /api/channels/{channelID}", apiDeleteChannelHandler)
+	mux.HandleFunc("POST /api/channels/{channelID}/purge", apiPurgeChannelHandler)
+	mux.HandleFunc("POST /api/channels/{channelID}/pause", apiPauseChannelHandler)
+	mux.HandleFunc("POST /api/channels/{channelID}/resume", apiResumeChannelHandler)
+	mux.HandleFunc("GET /api/channels/{channelID}/threads", apiThreadCleanupsHandler)
+	mux.HandleFunc("GET /api/audit", apiAuditHandler)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+
+	return requireAdminToken(mux)
+}
+
+// Reject requests without valid bearer token. Token is read from current config, so it can be changed without restart
+func requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		expected := "Bearer " + currentConfig().AdminAPIToken
+		actual := request.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+			writeAPIError(writer, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// List channels, all or of the guild
+func apiListChannelsHandler(writer http.ResponseWriter, request *http.Request) {
+	var channelsProperties []*cpstorage.ChannelPropertiesEntity
+	var err error
+	if guildID := request.URL.Query().Get("guild_id"); guildID != "" {
+		channelsProperties, err = cpstorage.GetGuildChannelsProperties(guildID)
+	} else {
+		channelsProperties, err = cpstorage.GetAllChannelsProperties()
+	}
+	if err != nil {
+		log.Printf("Admin API: failed to get channels: %v", err)
+		writeAPIError(writer, http.StatusInternalServerError, "failed to get channels")
+		return
+	}
+
+	channels := make([]apiChannel, len(channelsProperties))
+	for i, channelProperties := range channelsProperties {
+		channels[i] = toAPIChannel(channelProperties)
+	}
+	writeAPIResponse(writer, http.StatusOK, channels)
+}
+
+// Get channel
+func apiGetChannelHandler(writer http.ResponseWriter, request *http.Request) {
+	channelProperties, ok := getAPIChannelProperties(writer, request)
+	if !ok {
+		return
+	}
+	writeAPIResponse(writer, http.StatusOK, toAPIChannel(channelProperties))
+}
+
+// Create channel or change its timeout. Pause is kept, channel is checked immediately
+func apiPutChannelHandler(writer http.ResponseWriter, request *http.Request) {
+	channelID := request.PathValue("channelID")
+
+	var body apiPutChannelRequest
+	if !readAPIRequest(writer, request, &body) {
+		return
+	}
+
+	minHours, maxHours := getTimeoutLimits(currentConfig())
+	if body.TimeoutHours < minHours || body.TimeoutHours > maxHours {
+		writeAPIError(writer, http.StatusBadRequest, fmt.Sprintf("timeout_hours must be from %v to %v", minHours, maxHours))
+		return
+	}
+
+	oldChannelProperties, err := cpstorage.GetChannelProperties(channelID)
+	if err != nil {
+		log.Printf("Admin API: failed to get channel %s: %v", channelID, err)
+		writeAPIError(writer, http.StatusInternalServerError, "failed to get channel")
+		return
+	}
+
+	channelProperties := cpstorage.ChannelPropertiesEntity{
+		ChannelID:            channelID,
+		Timeout:              body.TimeoutHours,
+		LastActivityDateUnix: time.Now().Unix(),
+		NextRemoveDateUnix:   0, // Channel must be checked now
+		GuildID:              body.GuildID,
+	}
+	if oldChannelProperties != nil {
+		channelProperties.PausedUntilDateUnix = oldChannelProperties.PausedUntilDateUnix
+		channelProperties.IsPrecise = oldChannelProperties.IsPrecise
+		channelProperties.IsArchiveThreads = oldChannelProperties.IsArchiveThreads
+		if channelProperties.GuildID == "" {
+			channelProperties.GuildID = oldChannelProperties.GuildID
+		}
+	}
+
+	wasPrecise := channelProperties.IsPrecise
+	if body.IsPrecise != nil {
+		channelProperties.IsPrecise = *body.IsPrecise
+	}
+	if body.IsArchiveThreads != nil {
+		channelProperties.IsArchiveThreads = *body.IsArchiveThreads
+	}
+
+	// Guild is required to process channel by the right shard
+	if channelProperties.GuildID == "" {
+		channelProperties.GuildID, err = getChannelGuildID(channelID)
+		if err != nil && isErrorChannelUnavailable(err) {
+			writeAPIError(writer, http.StatusNotFound, "channel is not available to the bot")
+			return
+		} else if err != nil {
+			log.Printf("Admin API: failed to get guild of channel %s: %v", channelID, err)
+			writeAPIError(writer, http.StatusBadGateway, "failed to get guild of channel")
+			return
+		}
+	}
+
+	err = cpstorage.WriteChannelProperties(&channelProperties)
+	if err != nil {
+		log.Printf("Admin API: failed to save channel %s: %v", channelID, err)
+		writeAPIError(writer, http.StatusInternalServerError, "failed to save channel")
+		return
+	}
+	writeAuditEntry(channelProperties.GuildID, channelID, auditActorAPI, "set-timeout", "timeout "+сonvertFloatHoursToTimeString(body.TimeoutHours))
+	scheduleChangedChannel(channelID, channelProperties.PausedUntilDateUnix)
+	if channelProperties.IsPrecise && !wasPrecise && isOwnChannel(&channelProperties) {
+		go reconcileChannelExpiringMessages(&channelProperties)
+	}
+
+	writeAPIResponse(writer, http.StatusOK, toAPIChannel(&channelProperties))
+}
+
+// Stop deleting messages in channel
+func apiDeleteChannelHandler(writer http.ResponseWriter, request *http.Request) {
+	channelProperties, ok := getAPIChannelProperties(writer, request)
+	if !ok {
+		return
+	}
+
+	err := cpstorage.DeleteChannelProperties(channelProperties.ChannelID)
+	if err != nil {
+		log.Printf("Admin API: failed to delete channel %s: %v", channelProperties.ChannelID, err)
+		writeAPIError(writer, http.StatusInternalServerError, "failed to delete channel")
+		return
+	}
+	writeAuditEntry(channelProperties.GuildID, channelProperties.ChannelID, auditActorAPI, "remove-timeout", "")
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// Start purge of channel in background
+func apiPurgeChannelHandler(writer http.ResponseWriter, request *http.Request) {
+	channelProperties, ok := getAPIChannelProperties(writer, request)
+	if !ok {
+		return
+	}
+	channelID := channelProperties.ChannelID
+
+	var body apiPurgeRequest
+	if !readAPIRequest(writer, request, &body) {
+		return
+	}
+	if body.OlderThanHours < 0 || body.Limit < 0 {
+		writeAPIError(writer, http.StatusBadRequest, "older_than_hours and limit must not be negative")
+		return
+	}
+	if body.OlderThanHours > maximalDurationHours {
+		writeAPIError(writer, http.StatusBadRequest, fmt.Sprintf("older_than_hours must not be greater than %v", maximalDurationHours))
+		return
+	}
+
+	olderThanHours := channelProperties.Timeout
+	if body.OlderThanHours > 0 {
+		olderThanHours = body.OlderThanHours
+	}
+	options := purgeOptions{
+		ChannelID:     channelID,
+		OlderThanDate: time.Now().Add(-time.Duration(olderThanHours * float64(time.Hour))),
+		Limit:         body.Limit,
+		UserID:        body.UserID,
+	}
+
+	if _, isActive := activePurges.LoadOrStore(channelID, true); isActive {
+		writeAPIError(writer, http.StatusConflict, "channel is already being purged")
+		return
+	}
+	writeAuditEntry(channelProperties.GuildID, channelID, auditActorAPI, "purge-now", formatAuditPurge(options))
+
+	go func() {
+		defer activePurges.Delete(channelID)
+
+		result, err := purgeChannel(options, func(progress purgeResult) {})
+		if err != nil {
+			log.Printf("Admin API: failed to purge channel %s: %v", channelID, err)
+		}
+		log.Printf("Admin API: %d messages deleted and %d threads queued for cleanup in channel %s", result.MessagesNumber, result.ThreadsNumber, channelID)
+	}()
+
+	writer.WriteHeader(http.StatusAccepted)
+}
+
+// Pause deleting messages in channel
+func apiPauseChannelHandler(writer http.ResponseWriter, request *http.Request) {
+	channelProperties, ok := getAPIChannelProperties(writer, request)
+	if !ok {
+		return
+	}
+
+	var body apiPauseRequest
+	if !readAPIRequest(writer, request, &body) {
+		return
+	}
+	if body.DurationHours < 0 || body.DurationHours > maximalDurationHours {
+		writeAPIError(writer, http.StatusBadRequest, fmt.Sprintf("duration_hours must be from 0 to %v", maximalDurationHours))
+		return
+	}
+
+	// Without duration pause lasts until manual resume
+	pausedUntilDateUnix := cpstorage.PausedIndefinitely
+	if body.DurationHours > 0 {
+		pausedUntilDateUnix = time.Now().Add(time.Duration(body.DurationHours * float64(time.Hour))).Unix()
+	}
+
+	err := cpstorage.PauseChannel(channelProperties.ChannelID, pausedUntilDateUnix)
+	if err != nil {
+		log.Printf("Admin API: failed to pause channel %s: %v", channelProperties.ChannelID, err)
+		writeAPIError(writer, http.StatusInternalServerError, "failed to pause channel")
+		return
+	}
+	writeAuditEntry(channelProperties.GuildID, channelProperties.ChannelID, auditActorAPI, "pause-timeout", formatAuditPause(pausedUntilDateUnix))
+	scheduleChangedChannel(channelProperties.ChannelID, pausedUntilDateUnix)
+
+	channelProperties.PausedUntilDateUnix = pausedUntilDateUnix
+	writeAPIResponse(writer, http.StatusOK, toAPIChannel(channelProperties))
+}
+
+// Resume deleting messages in channel
+func apiResumeChannelHandler(writer http.ResponseWriter, request *http.Request) {
+	channelProperties, ok := getAPIChannelProperties(writer, request)
+	if !ok {
+		return
+	}
+
+	resumeDateUnix := time.Now().Unix()
+	if !channelProperties.IsPaused(resumeDateUnix) {
+		writeAPIError(writer, http.StatusConflict, "channel is not paused")
+		return
+	}
+
+	err := cpstorage.ResumeChannel(channelProperties.ChannelID, resumeDateUnix)
+	if err != nil {
+		log.Printf("Admin API: failed to resume channel %s: %v", channelProperties.ChannelID, err)
+		writeAPIError(writer, http.StatusInternalServerError, "failed to resume channel")
+		return
+	}
+	writeAuditEntry(channelProperties.GuildID, channelProperties.ChannelID, auditActorAPI, "resume-timeout", "")
+	scheduleChangedChannel(channelProperties.ChannelID, 0)
+
+	channelProperties.PausedUntilDateUnix = 0
+	channelProperties.NextRemoveDateUnix = 0
+	channelProperties.LastActivityDateUnix = resumeDateUnix
+	writeAPIResponse(writer, http.StatusOK, toAPIChannel(channelProperties))
+}
+
+// Get cleanups of threads of deleted messages in channel, from the latest changed
+func apiThreadCleanupsHandler(writer http.ResponseWriter, request *http.Request) {
+	channelID := request.PathValue("channelID")
+
+	threadCleanups, err := cpstorage.GetChannelThreadCleanups(channelID)
+	if err != nil {
+		log.Printf("Admin API: failed to get thread cleanups of channel %s: %v", channelID, err)
+		writeAPIError(writer, http.StatusInternalServerError, "failed to get thread cleanups")
+		return
+	}
+
+	response := make([]apiThreadCleanup, len(threadCleanups))
+	for i, threadCleanup := range threadCleanups {
+		response[i] = apiThreadCleanup{
+			ThreadID:        threadCleanup.ThreadID,
+			Status:          threadCleanup.Status,
+			Attempts:        threadCleanup.Attempts,
+			LastError:       threadCleanup.LastError,
+			NextAttemptDate: threadCleanup.NextAttemptDateUnix,
+			UpdatedDate:     threadCleanup.UpdatedDateUnix,
+		}
+	}
+	writeAPIResponse(writer, http.StatusOK, response)
+}
+
+// Get audit entries, from the newest
+func apiAuditHandler(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	filter := cpstorage.AuditFilter{
+		GuildID:   query.Get("guild_id"),
+		ChannelID: query.Get("channel_id"),
+		Limit:     defaultAuditLimit,
+	}
+
+	var err error
+	if value := query.Get("before_id"); value != "" {
+		filter.BeforeID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || filter.BeforeID <= 0 {
+			writeAPIError(writer, http.StatusBadRequest, "before_id must be a positive integer")
+			return
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxAuditLimit {
+			writeAPIError(writer, http.StatusBadRequest, fmt.Sprintf("limit must be from 1 to %d", maxAuditLimit))
+			return
+		}
+	}
+
+	auditEntries, err := cpstorage.GetAuditEntries(filter)
+	if err != nil {
+		log.Printf("Admin API: failed to get audit entries: %v", err)
+		writeAPIError(writer, http.StatusInternalServerError, "failed to get audit entries")
+		return
+	}
+
+	response := make([]apiAuditEntry, len(auditEntries))
+	for i, auditEntry := range auditEntries {
+		response[i] = apiAuditEntry{
+			ID:        auditEntry.ID,
+			Date:      auditEntry.DateUnix,
+			GuildID:   auditEntry.GuildID,
+			ChannelID: auditEntry.ChannelID,
+			Actor:     auditEntry.Actor,
+			Action:    auditEntry.Action,
+			Details:   auditEntry.Details,
+		}
+	}
+	writeAPIResponse(writer, http.StatusOK, response)
+}
+
+// Get properties of channel from request path. Responds with error if channel has no properties
+func getAPIChannelProperties(writer http.ResponseWriter, request *http.Request) (channelProperties *cpstorage.ChannelPropertiesEntity, ok bool) {
+	channelID := request.PathValue("channelID")
+
+	channelProperties, err := cpstorage.GetChannelProperties(channelID)
+	if err != nil {
+		log.Printf("Admin API: failed to get channel %s: %v", channelID, err)
+		writeAPIError(writer, http.StatusInternalServerError, "failed to get channel")
+		return nil, false
+	} else if channelProperties == nil {
+		writeAPIError(writer, http.StatusNotFound, "messages are not deleted in channel")
+		return nil, false
+	}
+	return channelProperties, true
+}
+
+// Decode JSON body of request. Empty body is allowed, all fields keep zero values then
+func readAPIRequest(writer http.ResponseWriter, request *http.Request, body any) (ok bool) {
+	decoder := json.NewDecoder(request.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(body)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeAPIError(writer, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeAPIResponse(writer http.ResponseWriter, status int, response any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+
+	err := json.NewEncoder(writer).Encode(response)
+	if err != nil {
+		log.Printf("Admin API: failed to write response: %v", err)
+	}
+}
+
+func writeAPIError(writer http.ResponseWriter, status int, message string) {
+	writeAPIResponse(writer, status, apiError{Error: message})
+}
+
+// Convert channel properties to API format
+func toAPIChannel(channelProperties *cpstorage.ChannelPropertiesEntity) apiChannel {
+	return apiChannel{
+		ChannelID:        channelProperties.ChannelID,
+		GuildID:          channelProperties.GuildID,
+		TimeoutHours:     channelProperties.Timeout,
+		LastActivityDate: channelProperties.LastActivityDateUnix,
+		NextRemoveDate:   channelProperties.NextRemoveDateUnix,
+		PausedUntilDate:  channelProperties.PausedUntilDateUnix,
+		IsPaused:         channelProperties.IsPaused(time.Now().Unix()),
+		IsPrecise:        channelProperties.IsPrecise,
+		IsArchiveThreads: channelProperties.IsArchiveThreads,
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cfgloader"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+const testAdminAPIToken = "test-token"
+
+// Start admin API on empty storage with test config. Storage is closed at the end of the test
+func newTestAdminAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	dir := t.TempDir()
+	configWatcher = cfgloader.NewWatcher(filepath.Join(dir, "config.ini"), cfgloader.Config{
+		MinimaOutdatelHoursValue:  0.1,
+		MaximumOutdateHoursValue:  1000,
+		OldDontRemoveTimeoutHours: 335,
+		AdminAPIToken:             testAdminAPIToken,
+	})
+	cpstorage.Init(cpstorage.DriverSQLite, filepath.Join(dir, "channels.db"))
+	t.Cleanup(func() { cpstorage.Close() })
+
+	server := httptest.NewServer(newAdminAPIHandler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Send request with token to admin API. Response body is decoded into response if it is not nil
+func doAPIRequest(t *testing.T, server *httptest.Server, method string, path string, body string, response any) (status int) {
+	t.Helper()
+
+	request, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	request.Header.Set("Authorization", "Bearer "+testAdminAPIToken)
+
+	httpResponse, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer httpResponse.Body.Close()
+
+	if response != nil {
+		err = json.NewDecoder(httpResponse.Body).Decode(response)
+		if err != nil {
+			t.Fatalf("Failed to decode response of %s %s: %v", method, path, err)
+		}
+	}
+	return httpResponse.StatusCode
+}
+
+func TestAdminAPIRequiresToken(t *testing.T) {
+	server := newTestAdminAPI(t)
+
+	for _, authorization := range []string{"", "Bearer wrong", testAdminAPIToken, "Bearer " + testAdminAPIToken + "x"} {
+		request, err := http.NewRequest(http.MethodGet, server.URL+"/api/channels", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+
+		response, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Status with authorization %q = %d, want %d", authorization, response.StatusCode, http.StatusUnauthorized)
+		}
+	}
+
+	if status := doAPIRequest(t, server, http.MethodGet, "/api/channels", "", nil); status != http.StatusOK {
+		t.Errorf("Status with valid token = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestAdminAPIChannel(t *testing.T) {
+	server := newTestAdminAPI(t)
+
+	var channel apiChannel
+	if status := doAPIRequest(t, server, http.MethodGet, "/api/channels/10", "", nil); status != http.StatusNotFound {
+		t.Fatalf("GET of unknown channel status = %d, want %d", status, http.StatusNotFound)
+	}
+
+	status := doAPIRequest(t, server, http.MethodPut, "/api/channels/10", `{"timeout_hours": 2, "guild_id": "1", "archive_threads": true}`, &channel)
+	if status != http.StatusOK || channel.TimeoutHours != 2 || channel.GuildID != "1" || !channel.IsArchiveThreads || channel.NextRemoveDate != 0 {
+		t.Fatalf("PUT = %d, %+v", status, channel)
+	}
+
+	// Options that are not specified are kept
+	status = doAPIRequest(t, server, http.MethodPut, "/api/channels/10", `{"timeout_hours": 3}`, &channel)
+	if status != http.StatusOK || channel.TimeoutHours != 3 || channel.GuildID != "1" || !channel.IsArchiveThreads {
+		t.Fatalf("Second PUT = %d, %+v", status, channel)
+	}
+
+	channel = apiChannel{}
+	status = doAPIRequest(t, server, http.MethodGet, "/api/channels/10", "", &channel)
+	if status != http.StatusOK || channel.ChannelID != "10" || channel.TimeoutHours != 3 {
+		t.Fatalf("GET = %d, %+v", status, channel)
+	}
+
+	var channels []apiChannel
+	status = doAPIRequest(t, server, http.MethodGet, "/api/channels?guild_id=1", "", &channels)
+	if status != http.StatusOK || len(channels) != 1 || channels[0].ChannelID != "10" {
+		t.Fatalf("GET of guild channels = %d, %+v", status, channels)
+	}
+
+	if status = doAPIRequest(t, server, http.MethodPut, "/api/channels/10", `{"timeout_hours": 5000, "guild_id": "1"}`, nil); status != http.StatusBadRequest {
+		t.Errorf("PUT with timeout over limit status = %d, want %d", status, http.StatusBadRequest)
+	}
+
+	if status = doAPIRequest(t, server, http.MethodDelete, "/api/channels/10", "", nil); status != http.StatusNoContent {
+		t.Fatalf("DELETE status = %d, want %d", status, http.StatusNoContent)
+	}
+	if status = doAPIRequest(t, server, http.MethodGet, "/api/channels/10", "", nil); status != http.StatusNotFound {
+		t.Errorf("GET of deleted channel status = %d, want %d", status, http.StatusNotFound)
+	}
+	if status = doAPIRequest(t, server, http.MethodDelete, "/api/channels/10", "", nil); status != http.StatusNotFound {
+		t.Errorf("Second DELETE status = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestAdminAPIPauseAndResume(t *testing.T) {
+	server := newTestAdminAPI(t)
+	doAPIRequest(t, server, http.MethodPut, "/api/channels/10", `{"timeout_hours": 2, "guild_id": "1"}`, nil)
+
+	if status := doAPIRequest(t, server, http.MethodPost, "/api/channels/20/pause", "", nil); status != http.StatusNotFound {
+		t.Errorf("Pause of unknown channel status = %d, want %d", status, http.StatusNotFound)
+	}
+	for _, body := range []string{`{"duration_hours": -1}`, `{"duration_hours": 1e300}`} {
+		if status := doAPIRequest(t, server, http.MethodPost, "/api/channels/10/pause", body, nil); status != http.StatusBadRequest {
+			t.Errorf("Pause with %s status = %d, want %d", body, status, http.StatusBadRequest)
+		}
+	}
+
+	var channel apiChannel
+	status := doAPIRequest(t, server, http.MethodPost, "/api/channels/10/pause", "", &channel)
+	if status != http.StatusOK || !channel.IsPaused || channel.PausedUntilDate != cpstorage.PausedIndefinitely {
+		t.Fatalf("Pause = %d, %+v", status, channel)
+	}
+	channelProperties, err := cpstorage.GetChannelProperties("10")
+	if err != nil || channelProperties.PausedUntilDateUnix != cpstorage.PausedIndefinitely {
+		t.Fatalf("Channel after pause = %+v, %v", channelProperties, err)
+	}
+
+	status = doAPIRequest(t, server, http.MethodPost, "/api/channels/10/resume", "", &channel)
+	if status != http.StatusOK || channel.IsPaused {
+		t.Fatalf("Resume = %d, %+v", status, channel)
+	}
+	if status = doAPIRequest(t, server, http.MethodPost, "/api/channels/10/resume", "", nil); status != http.StatusConflict {
+		t.Errorf("Resume of not paused channel status = %d, want %d", status, http.StatusConflict)
+	}
+}
+
+// Only requests rejected before purge starts are checked, started purge needs Discord session
+func TestAdminAPIPurge(t *testing.T) {
+	server := newTestAdminAPI(t)
+	doAPIRequest(t, server, http.MethodPut, "/api/channels/10", `{"timeout_hours": 2, "guild_id": "1"}`, nil)
+
+	if status := doAPIRequest(t, server, http.MethodPost, "/api/channels/20/purge", "", nil); status != http.StatusNotFound {
+		t.Errorf("Purge of unknown channel status = %d, want %d", status, http.StatusNotFound)
+	}
+	for _, body := range []string{`{"older_than_hours": -1}`, `{"limit": -1}`, `{"older_than_hours": 1e300}`} {
+		if status := doAPIRequest(t, server, http.MethodPost, "/api/channels/10/purge", body, nil); status != http.StatusBadRequest {
+			t.Errorf("Purge with %s status = %d, want %d", body, status, http.StatusBadRequest)
+		}
+	}
+
+	activePurges.Store("10", true)
+	defer activePurges.Delete("10")
+	if status := doAPIRequest(t, server, http.MethodPost, "/api/channels/10/purge", `{"limit": 10}`, nil); status != http.StatusConflict {
+		t.Errorf("Purge of channel being purged status = %d, want %d", status, http.StatusConflict)
+	}
+}
+
+func TestAdminAPIMalformedJSON(t *testing.T) {
+	server := newTestAdminAPI(t)
+	doAPIRequest(t, server, http.MethodPut, "/api/channels/10", `{"timeout_hours": 2, "guild_id": "1"}`, nil)
+
+	requests := []struct{ method, path, body string }{
+		{http.MethodPut, "/api/channels/10", `{"timeout_hours": `},
+		{http.MethodPut, "/api/channels/10", `{"timeout_hours": "2"}`},
+		{http.MethodPut, "/api/channels/10", `{"timeout_hours": 2, "unknown": 1}`},
+		{http.MethodPost, "/api/channels/10/pause", `[1]`},
+		{http.MethodPost, "/api/channels/10/purge", `{"limit": 1`},
+	}
+	for _, request := range requests {
+		var response apiError
+		status := doAPIRequest(t, server, request.method, request.path, request.body, &response)
+		if status != http.StatusBadRequest || response.Error == "" {
+			t.Errorf("%s %s with %s = %d, %+v; want %d with error", request.method, request.path, request.body, status, response, http.StatusBadRequest)
+		}
+	}
+
+	// Rejected requests don't change the channel
+	channelProperties, err := cpstorage.GetChannelProperties("10")
+	if err != nil || channelProperties.Timeout != 2 || channelProperties.IsPaused(0) {
+		t.Fatalf("Channel after malformed requests = %+v, %v", channelProperties, err)
+	}
+}
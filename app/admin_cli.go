@@ -0,0 +1,526 @@
+package main
+
+// Subcommands for managing the channels database. Use them while the bot is stopped or against a copy of the database
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cfgloader"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+const auditActorCLI = "cli" // Actor of changes made by admin subcommands
+
+// Create flag set of subcommand with -db and -config flags
+func newDatabaseFlagSet(name string, usage string) (flagSet *flag.FlagSet, dbPath *string) {
+	flagSet = flag.NewFlagSet(name, flag.ContinueOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s [-db path | -config path] %s\n", name, usage)
+		flagSet.PrintDefaults()
+	}
+	dbPath = flagSet.String("db", SharedDataPath+"/channels.db", "path to SQLite database file")
+	flagSet.String("config", SharedDataPath+"/config.ini", "config with [Storage] section, used if -db is not specified")
+	return flagSet, dbPath
+}
+
+// Parse subcommand args and open database, migrating it to the current schema. Returns false if args are invalid
+func parseDatabaseArgs(flagSet *flag.FlagSet, dbPath *string, args []string, minArgs int, maxArgs int) (ok bool) {
+	driver, dataSource, ok := parseStorageArgs(flagSet, dbPath, args, minArgs, maxArgs)
+	if !ok {
+		return false
+	}
+	cpstorage.Init(driver, dataSource)
+	return true
+}
+
+// Parse subcommand args and open SQLite database, migrating it to the current schema.
+// For subcommands working with the database file. Returns false if args are invalid or storage is not SQLite
+func parseSQLiteDatabaseArgs(flagSet *flag.FlagSet, dbPath *string, args []string, minArgs int, maxArgs int) (ok bool) {
+	driver, dataSource, ok := parseStorageArgs(flagSet, dbPath, args, minArgs, maxArgs)
+	if !ok {
+		return false
+	}
+	if driver != cpstorage.DriverSQLite {
+		fmt.Fprintf(os.Stderr, "%s works only with SQLite storage, use PostgreSQL tools for %s storage\n", flagSet.Name(), driver)
+		return false
+	}
+	cpstorage.Init(driver, dataSource)
+	return true
+}
+
+// Parse subcommand args and open database without changing it. Database of other schema version is refused,
+// so reading doesn't migrate it and doesn't leave backups. Returns false if args are invalid or database can't be read
+func parseReadOnlyDatabaseArgs(flagSet *flag.FlagSet, dbPath *string, args []string, minArgs int, maxArgs int) (ok bool) {
+	driver, dataSource, ok := parseStorageArgs(flagSet, dbPath, args, minArgs, maxArgs)
+	if !ok {
+		return false
+	}
+
+	err := cpstorage.InitExisting(driver, dataSource)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open storage: %v\n", err)
+		if errors.Is(err, cpstorage.ErrSchemaVersion) {
+			fmt.Fprintln(os.Stderr, "Start the bot of this version or run a changing subcommand to migrate it")
+		}
+		return false
+	}
+	return true
+}
+
+// Parse subcommand args and get storage driver and data source.
+// SQLite file from -db is used if it is specified, otherwise storage is taken from config as the bot does
+func parseStorageArgs(flagSet *flag.FlagSet, dbPath *string, args []string, minArgs int, maxArgs int) (driver string, dataSource string, ok bool) {
+	if err := flagSet.Parse(args); err != nil {
+		return "", "", false
+	}
+	if flagSet.NArg() < minArgs || flagSet.NArg() > maxArgs {
+		flagSet.Usage()
+		return "", "", false
+	}
+
+	isDBPathSet := false
+	flagSet.Visit(func(setFlag *flag.Flag) {
+		isDBPathSet = isDBPathSet || setFlag.Name == "db"
+	})
+
+	// Without config, e.g. against a copy of the database, default SQLite file is used
+	configPath := flagSet.Lookup("config").Value.String()
+	_, configErr := os.Stat(configPath)
+	if !isDBPathSet && configErr == nil {
+		config, ok := loadCLIConfig(flagSet)
+		if !ok {
+			return "", "", false
+		}
+		if config.StorageDriver == cpstorage.DriverPostgres {
+			return cpstorage.DriverPostgres, config.PostgresDSN, true
+		}
+	}
+
+	// Opening doesn't create the file, so typo in path is not hidden by empty database
+	if _, err := os.Stat(*dbPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Database %s: %v\n", *dbPath, err)
+		return "", "", false
+	}
+	return cpstorage.DriverSQLite, *dbPath, true
+}
+
+// Load config from -config path of subcommand. Prints error if config can't be loaded
+func loadCLIConfig(flagSet *flag.FlagSet) (config *cfgloader.Config, ok bool) {
+	configPath := flagSet.Lookup("config").Value.String()
+	loadedConfig, _, err := cfgloader.LoadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config %s:\n%v\n", configPath, err)
+		return nil, false
+	}
+	return &loadedConfig, true
+}
+
+// Print table of channels.
+// Usage: list [-db path] [-guild id]
+func listSubcommand(args []string) (exitCode int) {
+	flagSet, dbPath := newDatabaseFlagSet("list", "[-guild id]")
+	guildID := flagSet.String("guild", "", "show only channels of the guild")
+	if !parseReadOnlyDatabaseArgs(flagSet, dbPath, args, 0, 0) {
+		return 2
+	}
+	defer cpstorage.Close()
+
+	var channelsProperties []*cpstorage.ChannelPropertiesEntity
+	var err error
+	if *guildID != "" {
+		channelsProperties, err = cpstorage.GetGuildChannelsProperties(*guildID)
+	} else {
+		channelsProperties, err = cpstorage.GetAllChannelsProperties()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get channels: %v\n", err)
+		return 1
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "CHANNEL\tGUILD\tTIMEOUT\tNEXT REMOVE\tLAST ACTIVITY\tPAUSED UNTIL")
+	for _, channelProperties := range channelsProperties {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			channelProperties.ChannelID,
+			channelProperties.GuildID,
+			сonvertFloatHoursToTimeString(channelProperties.Timeout),
+			formatCLIDate(channelProperties.NextRemoveDateUnix),
+			formatCLIDate(channelProperties.LastActivityDateUnix),
+			formatCLIPause(channelProperties.PausedUntilDateUnix))
+	}
+	table.Flush()
+
+	fmt.Printf("%d channels\n", len(channelsProperties))
+	return 0
+}
+
+// Print channel properties and user timeouts.
+// Usage: show [-db path] <channel id>
+func showSubcommand(args []string) (exitCode int) {
+	flagSet, dbPath := newDatabaseFlagSet("show", "<channel id>")
+	if !parseReadOnlyDatabaseArgs(flagSet, dbPath, args, 1, 1) {
+		return 2
+	}
+	defer cpstorage.Close()
+
+	channelProperties, ok := getCLIChannelProperties(flagSet.Arg(0))
+	if !ok {
+		return 1
+	}
+
+	userTimeouts, err := cpstorage.GetChannelUserTimeouts(channelProperties.ChannelID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get user timeouts: %v\n", err)
+		return 1
+	}
+
+	threadsCleanup := "delete"
+	if channelProperties.IsArchiveThreads {
+		threadsCleanup = "archive if active"
+	}
+
+	fmt.Printf("Channel:       %s\n", channelProperties.ChannelID)
+	fmt.Printf("Guild:         %s\n", channelProperties.GuildID)
+	fmt.Printf("Timeout:       %s\n", сonvertFloatHoursToTimeString(channelProperties.Timeout))
+	fmt.Printf("Precise:       %t\n", channelProperties.IsPrecise)
+	fmt.Printf("Threads:       %s\n", threadsCleanup)
+	fmt.Printf("Next remove:   %s\n", formatCLIDate(channelProperties.NextRemoveDateUnix))
+	fmt.Printf("Last activity: %s\n", formatCLIDate(channelProperties.LastActivityDateUnix))
+	fmt.Printf("Paused until:  %s\n", formatCLIPause(channelProperties.PausedUntilDateUnix))
+	for _, userTimeout := range userTimeouts {
+		fmt.Printf("User %s timeout: %s\n", userTimeout.UserID, сonvertFloatHoursToTimeString(userTimeout.Timeout))
+	}
+	return 0
+}
+
+// Set channel timeout. Pause is kept, channel is checked as soon as the bot starts.
+// Usage: set [-db path] [-guild id] [-precise=true|false] [-archive-threads=true|false] <channel id> <duration>
+func setSubcommand(args []string) (exitCode int) {
+	flagSet, dbPath := newDatabaseFlagSet("set", "[-guild id] [-precise=true|false] [-archive-threads=true|false] <channel id> <duration>")
+	guildID := flagSet.String("guild", "", "guild of the channel (resolved by the bot if unknown)")
+	isPrecise := flagSet.Bool("precise", false, "delete every message exactly when it becomes outdated (kept if not specified)")
+	isArchiveThreads := flagSet.Bool("archive-threads", false, "archive threads with recent messages instead of deleting them (kept if not specified)")
+	if !parseDatabaseArgs(flagSet, dbPath, args, 2, 2) {
+		return 2
+	}
+	defer cpstorage.Close()
+
+	channelID := flagSet.Arg(0)
+	hours, err := parseDurationHours(flagSet.Arg(1))
+	if err != nil || hours <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid duration %q. Use for example 90m, 3d12h or 1w\n", flagSet.Arg(1))
+		return 2
+	}
+
+	// Timeout limits are the same as for the command in Discord
+	config, ok := loadCLIConfig(flagSet)
+	if !ok {
+		return 2
+	}
+	minHours, maxHours := getTimeoutLimits(config)
+	if hours < minHours || hours > maxHours {
+		fmt.Fprintf(os.Stderr, "Duration must be from %s to %s\n", сonvertFloatHoursToTimeString(minHours), сonvertFloatHoursToTimeString(maxHours))
+		return 2
+	}
+
+	oldChannelProperties, err := cpstorage.GetChannelProperties(channelID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get channel: %v\n", err)
+		return 1
+	}
+
+	channelProperties := cpstorage.ChannelPropertiesEntity{
+		ChannelID:            channelID,
+		Timeout:              hours,
+		LastActivityDateUnix: time.Now().Unix(),
+		NextRemoveDateUnix:   0, // Channel must be checked now
+		GuildID:              *guildID,
+	}
+	if oldChannelProperties != nil {
+		channelProperties.PausedUntilDateUnix = oldChannelProperties.PausedUntilDateUnix
+		channelProperties.IsPrecise = oldChannelProperties.IsPrecise
+		channelProperties.IsArchiveThreads = oldChannelProperties.IsArchiveThreads
+		if channelProperties.GuildID == "" {
+			channelProperties.GuildID = oldChannelProperties.GuildID
+		}
+	}
+	flagSet.Visit(func(setFlag *flag.Flag) {
+		switch setFlag.Name {
+		case "precise":
+			channelProperties.IsPrecise = *isPrecise
+		case "archive-threads":
+			channelProperties.IsArchiveThreads = *isArchiveThreads
+		}
+	})
+
+	err = cpstorage.WriteChannelProperties(&channelProperties)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save channel: %v\n", err)
+		return 1
+	}
+	writeAuditEntry(channelProperties.GuildID, channelID, auditActorCLI, "set-timeout", "timeout "+сonvertFloatHoursToTimeString(hours))
+
+	fmt.Printf("Messages in channel %s sent more than %s ago will be deleted\n", channelID, сonvertFloatHoursToTimeString(hours))
+	return 0
+}
+
+// Stop deleting messages in channel.
+// Usage: delete [-db path] <channel id>
+func deleteSubcommand(args []string) (exitCode int) {
+	flagSet, dbPath := newDatabaseFlagSet("delete", "<channel id>")
+	if !parseDatabaseArgs(flagSet, dbPath, args, 1, 1) {
+		return 2
+	}
+	defer cpstorage.Close()
+
+	channelProperties, ok := getCLIChannelProperties(flagSet.Arg(0))
+	if !ok {
+		return 1
+	}
+
+	err := cpstorage.DeleteChannelProperties(channelProperties.ChannelID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to delete channel: %v\n", err)
+		return 1
+	}
+	writeAuditEntry(channelProperties.GuildID, channelProperties.ChannelID, auditActorCLI, "remove-timeout", "")
+
+	fmt.Printf("Deleting messages in channel %s has been stopped\n", channelProperties.ChannelID)
+	return 0
+}
+
+// Pause deleting messages in channel for duration or until resume.
+// Usage: pause [-db path] <channel id> [duration]
+func pauseSubcommand(args []string) (exitCode int) {
+	flagSet, dbPath := newDatabaseFlagSet("pause", "<channel id> [duration]")
+	if !parseDatabaseArgs(flagSet, dbPath, args, 1, 2) {
+		return 2
+	}
+	defer cpstorage.Close()
+
+	// Without duration pause lasts until manual resume
+	pausedUntilDateUnix := cpstorage.PausedIndefinitely
+	if flagSet.NArg() == 2 {
+		hours, err := parseDurationHours(flagSet.Arg(1))
+		if err != nil || hours <= 0 || hours > maximalDurationHours {
+			fmt.Fprintf(os.Stderr, "Invalid duration %q. Use for example 90m, 3d12h or 1w\n", flagSet.Arg(1))
+			return 2
+		}
+		pausedUntilDateUnix = time.Now().Add(time.Duration(hours * float64(time.Hour))).Unix()
+	}
+
+	channelProperties, ok := getCLIChannelProperties(flagSet.Arg(0))
+	if !ok {
+		return 1
+	}
+
+	err := cpstorage.PauseChannel(channelProperties.ChannelID, pausedUntilDateUnix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to pause channel: %v\n", err)
+		return 1
+	}
+	writeAuditEntry(channelProperties.GuildID, channelProperties.ChannelID, auditActorCLI, "pause-timeout", formatAuditPause(pausedUntilDateUnix))
+
+	fmt.Printf("Deleting messages in channel %s is paused until %s\n", channelProperties.ChannelID, formatCLIPause(pausedUntilDateUnix))
+	return 0
+}
+
+// Resume deleting messages in channel.
+// Usage: resume [-db path] <channel id>
+func resumeSubcommand(args []string) (exitCode int) {
+	flagSet, dbPath := newDatabaseFlagSet("resume", "<channel id>")
+	if !parseDatabaseArgs(flagSet, dbPath, args, 1, 1) {
+		return 2
+	}
+	defer cpstorage.Close()
+
+	channelProperties, ok := getCLIChannelProperties(flagSet.Arg(0))
+	if !ok {
+		return 1
+	}
+
+	err := cpstorage.ResumeChannel(channelProperties.ChannelID, time.Now().Unix())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to resume channel: %v\n", err)
+		return 1
+	}
+	writeAuditEntry(channelProperties.GuildID, channelProperties.ChannelID, auditActorCLI, "resume-timeout", "")
+
+	fmt.Printf("Deleting messages in channel %s has been resumed\n", channelProperties.ChannelID)
+	return 0
+}
+
+// Write configuration of all channels and guilds as versioned JSON document.
+// Usage: export [-db path] [-guild id] [-o file]
+func exportSubcommand(args []string) (exitCode int) {
+	flagSet, dbPath := newDatabaseFlagSet("export", "[-guild id] [-o file]")
+	guildID := flagSet.String("guild", "", "export only channels and settings of the guild")
+	outputPath := flagSet.String("o", "", "output file (standard output by default)")
+	if !parseReadOnlyDatabaseArgs(flagSet, dbPath, args, 0, 0) {
+		return 2
+	}
+	defer cpstorage.Close()
+
+	document, err := cpstorage.Export(*guildID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export configuration: %v\n", err)
+		return 1
+	}
+
+	output := os.Stdout
+	if *outputPath != "" {
+		output, err = os.Create(*outputPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", *outputPath, err)
+			return 1
+		}
+		defer output.Close()
+	}
+
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(document)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write configuration: %v\n", err)
+		return 1
+	}
+
+	if *outputPath != "" {
+		fmt.Printf("%d channels exported to %s\n", len(document.Channels), *outputPath)
+	}
+	return 0
+}
+
+// Import configuration from document written by export. "-" reads standard input.
+// Usage: import [-db path] [-mode merge|replace] <file>
+func importSubcommand(args []string) (exitCode int) {
+	flagSet, dbPath := newDatabaseFlagSet("import", "[-mode merge|replace] <file>")
+	mode := flagSet.String("mode", cpstorage.ImportMerge, "merge - keep channels missing in file, replace - delete them")
+	if !parseDatabaseArgs(flagSet, dbPath, args, 1, 1) {
+		return 2
+	}
+	defer cpstorage.Close()
+
+	input := os.Stdin
+	if flagSet.Arg(0) != "-" {
+		var err error
+		input, err = os.Open(flagSet.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open %s: %v\n", flagSet.Arg(0), err)
+			return 1
+		}
+		defer input.Close()
+	}
+
+	document, err := cpstorage.DecodeExportDocument(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	err = cpstorage.Import(document, *mode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to import configuration: %v\n", err)
+		return 1
+	}
+	writeAuditEntry("", "", auditActorCLI, "import", fmt.Sprintf("%s, %d channels", *mode, len(document.Channels)))
+
+	fmt.Printf("%d channels, %d user timeouts and %d guild settings imported (%s)\n",
+		len(document.Channels), len(document.UserTimeouts), len(document.GuildSettings), *mode)
+	return 0
+}
+
+// Make all channels to be checked for outdated messages as soon as the bot starts.
+// Usage: reschedule [-db path]
+func rescheduleSubcommand(args []string) (exitCode int) {
+	flagSet, dbPath := newDatabaseFlagSet("reschedule", "")
+	if !parseDatabaseArgs(flagSet, dbPath, args, 0, 0) {
+		return 2
+	}
+	defer cpstorage.Close()
+
+	channelsNumber, err := cpstorage.RescheduleAllChannels()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to reschedule channels: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%d channels will be checked immediately\n", channelsNumber)
+	return 0
+}
+
+// Rebuild the database file to reclaim unused space.
+// Usage: vacuum [-db path]
+func vacuumSubcommand(args []string) (exitCode int) {
+	flagSet, dbPath := newDatabaseFlagSet("vacuum", "")
+	if !parseSQLiteDatabaseArgs(flagSet, dbPath, args, 0, 0) {
+		return 2
+	}
+	defer cpstorage.Close()
+
+	err := cpstorage.Vacuum()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to vacuum database: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%s is vacuumed\n", *dbPath)
+	return 0
+}
+
+// Write consistent copy of the database to the file.
+// Usage: backup [-db path] <backup path>
+func backupSubcommand(args []string) (exitCode int) {
+	flagSet, dbPath := newDatabaseFlagSet("backup", "<backup path>")
+	if !parseSQLiteDatabaseArgs(flagSet, dbPath, args, 1, 1) {
+		return 2
+	}
+	defer cpstorage.Close()
+
+	err := cpstorage.Backup(flagSet.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to backup database: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%s is backed up to %s\n", *dbPath, flagSet.Arg(0))
+	return 0
+}
+
+// Get channel properties. Prints error if channel has no properties
+func getCLIChannelProperties(channelID string) (channelProperties *cpstorage.ChannelPropertiesEntity, ok bool) {
+	channelProperties, err := cpstorage.GetChannelProperties(channelID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get channel: %v\n", err)
+		return nil, false
+	} else if channelProperties == nil {
+		fmt.Fprintf(os.Stderr, "Messages are not deleted in channel %s\n", channelID)
+		return nil, false
+	}
+	return channelProperties, true
+}
+
+// Format date (unix time) for terminal. 0 is shown as "now"
+func formatCLIDate(dateUnix int64) string {
+	if dateUnix == 0 {
+		return "now"
+	}
+	return time.Unix(dateUnix, 0).Format(time.DateTime)
+}
+
+// Format pause end for terminal
+func formatCLIPause(pausedUntilDateUnix int64) string {
+	switch pausedUntilDateUnix {
+	case 0:
+		return "-"
+	case cpstorage.PausedIndefinitely:
+		return "resume"
+	}
+	return time.Unix(pausedUntilDateUnix, 0).Format(time.DateTime)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+// Create empty database and config with the storage section in the test directory
+func newTestCLIFiles(t *testing.T, storageSection string) (dbPath string, configPath string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	dbPath = filepath.Join(dir, "channels.db")
+	cpstorage.Init(cpstorage.DriverSQLite, dbPath)
+	cpstorage.Close()
+
+	configPath = filepath.Join(dir, "config.ini")
+	config := `
+[Bot]
+BotToken = token
+
+[Time]
+MinimalOutdateHoursValue = 1
+MaximumOutdateHoursValue = 48
+` + storageSection
+	err := os.WriteFile(configPath, []byte(config), 0666)
+	if err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return dbPath, configPath
+}
+
+// Timeout of set subcommand has the limits of the command in Discord
+func TestSetSubcommandTimeoutLimits(t *testing.T) {
+	dbPath, configPath := newTestCLIFiles(t, "")
+
+	tests := []struct {
+		duration string
+		exitCode int
+	}{
+		{"30m", 2},
+		{"3d", 2},
+		{"1d", 0},
+	}
+	for _, test := range tests {
+		exitCode := setSubcommand([]string{"-db", dbPath, "-config", configPath, "10", test.duration})
+		if exitCode != test.exitCode {
+			t.Errorf("set with duration %s exited with %d, want %d", test.duration, exitCode, test.exitCode)
+		}
+	}
+}
+
+// Database file subcommands refuse PostgreSQL storage before connecting to it
+func TestFileSubcommandsRefusePostgres(t *testing.T) {
+	_, configPath := newTestCLIFiles(t, `
+[Storage]
+Driver = postgres
+PostgresDSN = postgres://localhost:1/unused
+`)
+
+	if exitCode := vacuumSubcommand([]string{"-config", configPath}); exitCode != 2 {
+		t.Errorf("vacuum of postgres storage exited with %d, want 2", exitCode)
+	}
+	if exitCode := backupSubcommand([]string{"-config", configPath, filepath.Join(t.TempDir(), "backup.db")}); exitCode != 2 {
+		t.Errorf("backup of postgres storage exited with %d, want 2", exitCode)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+// Audit of changes of channels settings
+
+import (
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+const auditActorAPI = "api" // Actor of changes made by admin API
+
+// Save audit entry. Failure to save is only logged, it must not fail the change itself
+func writeAuditEntry(guildID string, channelID string, actor string, action string, details string) {
+	err := cpstorage.WriteAuditEntry(&cpstorage.AuditEntryEntity{
+		DateUnix:  time.Now().Unix(),
+		GuildID:   guildID,
+		ChannelID: channelID,
+		Actor:     actor,
+		Action:    action,
+		Details:   details,
+	})
+	if err != nil {
+		log.Printf("Failed to write audit entry %s for channel %s: %v", action, channelID, err)
+	}
+}
+
+// Save audit entry of change made by command. Action is the command name
+func writeInteractionAuditEntry(interaction *discordgo.InteractionCreate, channelID string, details string) {
+	actor := "user:" + getInteractionUserID(interaction)
+	writeAuditEntry(interaction.GuildID, channelID, actor, interaction.ApplicationCommandData().Name, details)
+}
+
+// Format pause end for audit
+func formatAuditPause(pausedUntilDateUnix int64) string {
+	if pausedUntilDateUnix == cpstorage.PausedIndefinitely {
+		return "until resume"
+	}
+	return "until " + time.Unix(pausedUntilDateUnix, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,170 @@
+package main
+
+// Periodic backups of SQLite database and restoring it from backup at startup
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+const (
+	backupFilePrefix    = "channels-"
+	backupFileSuffix    = ".db"
+	backupDateLayout    = "20060102-150405" // Backups are sorted by name from the oldest
+	backupCheckInterval = time.Minute       // How often the job checks if backup is due
+)
+
+// Directory of database backups
+func getBackupsPath() string {
+	return SharedDataPath + "/backups"
+}
+
+// Back up database every interval from config and delete old backups. Blocks forever.
+// Interval and number of backups are read on each check, so they can be changed without restart
+func RunBackups() {
+	for {
+		config := currentConfig()
+		if config.BackupIntervalHours > 0 {
+			lastBackupDate := getLastBackupDate()
+			interval := time.Duration(config.BackupIntervalHours * float64(time.Hour))
+			if time.Since(lastBackupDate) >= interval {
+				backupDatabase(config.BackupKeepCount)
+			}
+		}
+
+		time.Sleep(backupCheckInterval)
+	}
+}
+
+// Write backup, check it and delete backups over keepCount
+func backupDatabase(keepCount int) {
+	err := os.MkdirAll(getBackupsPath(), 0755)
+	if err != nil {
+		log.Printf("Failed to create backups folder: %v", err)
+		return
+	}
+
+	backupPath := filepath.Join(getBackupsPath(), backupFilePrefix+time.Now().Format(backupDateLayout)+backupFileSuffix)
+	err = cpstorage.Backup(backupPath)
+	if err != nil {
+		log.Printf("Failed to back up database: %v", err)
+		return
+	}
+
+	// Broken backup is worse than none, it could be used for restore
+	err = cpstorage.CheckIntegrity(backupPath)
+	if err != nil {
+		log.Printf("Backup %s is broken and deleted: %v", backupPath, err)
+		os.Remove(backupPath)
+		return
+	}
+	log.Printf("Database is backed up to %s", backupPath)
+
+	backupPaths := getBackupPaths()
+	for len(backupPaths) > keepCount {
+		err = os.Remove(backupPaths[0])
+		if err != nil {
+			log.Printf("Failed to delete old backup %s: %v", backupPaths[0], err)
+		}
+		backupPaths = backupPaths[1:]
+	}
+}
+
+// Get paths of backups from the oldest
+func getBackupPaths() (backupPaths []string) {
+	backupPaths, err := filepath.Glob(filepath.Join(getBackupsPath(), backupFilePrefix+"*"+backupFileSuffix))
+	if err != nil {
+		log.Printf("Failed to list backups: %v", err)
+		return nil
+	}
+	slices.Sort(backupPaths)
+	return backupPaths
+}
+
+// Get date of the newest backup. Zero if there are no backups
+func getLastBackupDate() time.Time {
+	backupPaths := getBackupPaths()
+	if len(backupPaths) == 0 {
+		return time.Time{}
+	}
+
+	fileInfo, err := os.Stat(backupPaths[len(backupPaths)-1])
+	if err != nil {
+		return time.Time{}
+	}
+	return fileInfo.ModTime()
+}
+
+// Check database at startup and replace it with the newest valid backup if it is corrupted.
+// Corrupted file is kept next to the database
+func restoreCorruptedDatabase(dbPath string) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return
+	}
+
+	integrityErr := cpstorage.CheckIntegrity(dbPath)
+	if integrityErr == nil {
+		return
+	}
+	log.Printf("Database %s failed integrity check: %v", dbPath, integrityErr)
+
+	backupPaths := getBackupPaths()
+	for i := len(backupPaths) - 1; i >= 0; i-- {
+		err := cpstorage.CheckIntegrity(backupPaths[i])
+		if err != nil {
+			log.Printf("Backup %s is skipped: %v", backupPaths[i], err)
+			continue
+		}
+
+		corruptedPath := fmt.Sprintf("%s.corrupted-%s", dbPath, time.Now().Format(backupDateLayout))
+		err = os.Rename(dbPath, corruptedPath)
+		if err != nil {
+			log.Fatalf("Failed to move corrupted database to %s: %v", corruptedPath, err)
+		}
+
+		// Journal files belong to the corrupted database and must not be applied to the restored one
+		for _, journalSuffix := range []string{"-wal", "-shm", "-journal"} {
+			if _, err := os.Stat(dbPath + journalSuffix); err == nil {
+				os.Rename(dbPath+journalSuffix, corruptedPath+journalSuffix)
+			}
+		}
+
+		err = copyFile(backupPaths[i], dbPath)
+		if err != nil {
+			log.Fatalf("Failed to restore database from %s: %v", backupPaths[i], err)
+		}
+
+		log.Printf("Database is restored from %s, corrupted database is moved to %s", backupPaths[i], corruptedPath)
+		return
+	}
+
+	log.Fatalf("Database %s is corrupted and there is no valid backup in %s", dbPath, getBackupsPath())
+}
+
+// Copy file contents to new file
+func copyFile(sourcePath string, destinationPath string) (err error) {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.OpenFile(destinationPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(destination, source)
+	if err != nil {
+		destination.Close()
+		return err
+	}
+	return destination.Close()
+}
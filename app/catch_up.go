@@ -0,0 +1,191 @@
+package main
+
+// Catching up after downtime. Messages outdated while the bot was offline are deleted before they become too old for bulk delete
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+const (
+	heartbeatInterval  = time.Minute // Heartbeat of the remover loop is saved so often
+	catchUpMinDowntime = time.Hour   // Shorter downtime is handled by usual passes
+	catchUpMaxPages    = 100         // Maximum number of history pages checked in channel
+	catchUpPageLen     = 100         // Number of messages in history page
+)
+
+var (
+	lastHeartbeatDate time.Time // Date when heartbeat was saved last time
+)
+
+// ID of this process in heartbeats. Processes are distinguished by their shards from config,
+// so change of shard count recommended by Discord doesn't lose the heartbeat
+func getHeartbeatProcessID() string {
+	if len(configShardIDs) == 0 {
+		return "all shards"
+	}
+	sortedShardIDs := slices.Clone(configShardIDs)
+	slices.Sort(sortedShardIDs)
+	return fmt.Sprintf("shards %v", sortedShardIDs)
+}
+
+// Save heartbeat of the remover loop, not more often than heartbeatInterval
+func writeHeartbeat() {
+	if time.Since(lastHeartbeatDate) < heartbeatInterval {
+		return
+	}
+
+	err := cpstorage.WriteHeartbeat(getHeartbeatProcessID(), time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to save heartbeat: %v", err)
+		return
+	}
+	lastHeartbeatDate = time.Now()
+}
+
+// Delete messages outdated during downtime, if the bot was offline for long.
+// Channels with the nearest bulk delete deadline are processed first
+func catchUpAfterDowntime() {
+	heartbeatDateUnix, isFound, err := cpstorage.GetHeartbeat(getHeartbeatProcessID())
+	if err != nil {
+		log.Printf("Failed to get heartbeat: %v", err)
+		return
+	} else if !isFound {
+		// First run, downtime is unknown
+		return
+	}
+
+	heartbeatDate := time.Unix(heartbeatDateUnix, 0)
+	downtime := time.Since(heartbeatDate)
+	if downtime < catchUpMinDowntime {
+		return
+	}
+	log.Printf("Bot was offline for %s, catching up...", downtime.Round(time.Minute))
+
+	channelsProperties, err := cpstorage.GetAllChannelsProperties()
+	if err != nil {
+		log.Printf("Failed to get channels for catching up: %v", err)
+		return
+	}
+
+	nowUnix := time.Now().Unix()
+	var channelsToCatchUp []*cpstorage.ChannelPropertiesEntity
+	for _, channelProperties := range channelsProperties {
+		if isOwnChannel(channelProperties) && !channelProperties.IsPaused(nowUnix) && channelProperties.NextRemoveDateUnix <= nowUnix {
+			channelsToCatchUp = append(channelsToCatchUp, channelProperties)
+		}
+	}
+
+	sortChannelsByDeadline(channelsToCatchUp)
+
+	deletedNumber, undeletableNumber := 0, 0
+	for _, channelProperties := range channelsToCatchUp {
+		channelDeletedNumber, channelUndeletableNumber, err := catchUpChannel(channelProperties, heartbeatDate)
+		deletedNumber += channelDeletedNumber
+		undeletableNumber += channelUndeletableNumber
+
+		if err != nil && isErrorChannelUnavailable(err) {
+			// Channel is deleted by the remover
+			continue
+		} else if err != nil {
+			log.Printf("Failed to catch up channel %s: %v", channelProperties.ChannelID, err)
+		}
+		if channelUndeletableNumber > 0 {
+			log.Printf("%d outdated messages in channel %s became too old for bulk delete during downtime", channelUndeletableNumber, channelProperties.ChannelID)
+		}
+	}
+
+	log.Printf("Catching up is finished: %d messages deleted in %d channels, %d messages became too old for bulk delete",
+		deletedNumber, len(channelsToCatchUp), undeletableNumber)
+}
+
+// Delete outdated messages of channel from the oldest ones, without limit of batch size.
+// Returns number of deleted messages and number of outdated messages that became too old for bulk delete after heartbeat date
+func catchUpChannel(channelProperties *cpstorage.ChannelPropertiesEntity, heartbeatDate time.Time) (deletedNumber int, undeletableNumber int, err error) {
+	channelID := channelProperties.ChannelID
+
+	userTimeouts, err := cpstorage.GetChannelUserTimeouts(channelID)
+	if err != nil {
+		return 0, 0, err
+	}
+	lifetimes := newChannelLifetimes(channelProperties, userTimeouts)
+
+	// Messages between these dates could be bulk deleted at heartbeat but not now
+	oldDontRemoveTimeout := time.Hour * time.Duration(currentConfig().OldDontRemoveTimeoutHours)
+	tooOldAtHeartbeatSnowflakeId := TimestampToSnowflakeId(heartbeatDate.Add(-oldDontRemoveTimeout))
+	tooOldSnowflakeId := getTooOldTimeInSnoflakeIdFormat()
+
+	undeletableNumber, err = countOutdatedMessages(channelID, tooOldAtHeartbeatSnowflakeId, tooOldSnowflakeId, lifetimes)
+	if err != nil {
+		return 0, undeletableNumber, err
+	}
+
+	// Messages are deleted from the oldest, they are the first to become too old
+	shortestLifetimeProperties := *channelProperties
+	shortestLifetimeProperties.Timeout = lifetimes.shortestTimeout()
+	outdateSnowflakeId := getChannelOutdateTimeInSnowflakeIdFormat(&shortestLifetimeProperties)
+	afterSnowflakeId := tooOldSnowflakeId
+
+	for page := 0; page < catchUpMaxPages; page++ {
+		messages, err := Session.ChannelMessages(channelID, catchUpPageLen, "", afterSnowflakeId, "")
+		if err != nil {
+			return deletedNumber, undeletableNumber, err
+		}
+		if len(messages) == 0 {
+			break
+		}
+
+		// Messages are returned from the newest to the oldest. Next page starts after the newest one
+		afterSnowflakeId = messages[0].ID
+
+		outdatedMessages := lifetimes.filterOutdatedMessages(filterRemovableMessages(messages))
+		_, err = deleteChannelMessages(channelProperties, outdatedMessages)
+		if err != nil {
+			return deletedNumber, undeletableNumber, err
+		}
+		deletedNumber += len(outdatedMessages)
+
+		// Newer messages are not outdated yet
+		if len(messages) < catchUpPageLen || afterSnowflakeId > outdateSnowflakeId {
+			break
+		}
+	}
+
+	if deletedNumber > 0 {
+		log.Printf("Caught up channel %s: %d messages deleted", channelID, deletedNumber)
+	}
+	return deletedNumber, undeletableNumber, nil
+}
+
+// Count outdated messages of channel sent between snowflake IDs, that must be deleted but can't be bulk deleted
+func countOutdatedMessages(channelID string, afterSnowflakeId string, beforeSnowflakeId string, lifetimes channelLifetimes) (outdatedNumber int, err error) {
+	for page := 0; page < catchUpMaxPages && afterSnowflakeId < beforeSnowflakeId; page++ {
+		messages, err := Session.ChannelMessages(channelID, catchUpPageLen, "", afterSnowflakeId, "")
+		if err != nil {
+			return outdatedNumber, err
+		}
+		if len(messages) == 0 {
+			break
+		}
+		afterSnowflakeId = messages[0].ID
+
+		var tooOldMessages []*discordgo.Message
+		for _, message := range messages {
+			if message.ID < beforeSnowflakeId {
+				tooOldMessages = append(tooOldMessages, message)
+			}
+		}
+		tooOldMessages = excludeThreadStartMessages(excludePinnedMessages(tooOldMessages))
+		outdatedNumber += len(lifetimes.filterOutdatedMessages(tooOldMessages))
+
+		if len(messages) < catchUpPageLen {
+			break
+		}
+	}
+	return outdatedNumber, nil
+}
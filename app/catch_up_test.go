@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+// Heartbeat of the process is found again if Discord recommends other shard count
+func TestGetHeartbeatProcessID(t *testing.T) {
+	defer func(oldConfigShardIDs []int, oldShardCount int) {
+		configShardIDs, shardCount = oldConfigShardIDs, oldShardCount
+	}(configShardIDs, shardCount)
+
+	configShardIDs = nil
+	shardCount = 1
+	allShardsID := getHeartbeatProcessID()
+	shardCount = 2
+	if processID := getHeartbeatProcessID(); processID != allShardsID {
+		t.Errorf("Heartbeat ID with changed shard count = %q, want %q", processID, allShardsID)
+	}
+
+	configShardIDs = []int{2, 0}
+	if processID := getHeartbeatProcessID(); processID == allShardsID {
+		t.Errorf("Heartbeat ID of shards %v is the same as of all shards", configShardIDs)
+	}
+	processID := getHeartbeatProcessID()
+	configShardIDs = []int{0, 2}
+	if sameProcessID := getHeartbeatProcessID(); sameProcessID != processID {
+		t.Errorf("Heartbeat ID of shards [0 2] = %q, of shards [2 0] = %q, want the same", sameProcessID, processID)
+	}
+}
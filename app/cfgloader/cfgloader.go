@@ -1,15 +1,24 @@
 package cfgloader
 
 import (
+	"errors"
 	"fmt"
 
 	"gopkg.in/ini.v1"
 )
 
+const (
+	CommandsScopeGlobal = "global" // Commands are registered for all guilds. Discord may apply changes with a delay
+	CommandsScopeGuilds = "guilds" // Commands are registered only in DevGuildIDs. Changes are applied instantly
+)
+
 // Config структура для хранения конфигурационных параметров
 type Config struct {
 	BotToken                          string
-	GuildID                           string
+	CommandsScope                     string   // "global" or "guilds"
+	DevGuildIDs                       []string // Guilds to register commands in for "guilds" scope
+	ShardCount                        int      // Total number of gateway shards. 0 - recommended by Discord
+	ShardIDs                          []int    // Shards run by this process. Empty - all shards
 	IsLogToFile                       bool
 	MaximumOutdateHoursValue          float64
 	MinimaOutdatelHoursValue          float64
@@ -17,74 +26,99 @@ type Config struct {
 	RemoveInactiveChannelTimeoutHours float64
 	RemoveBatchSize                   int
 	OldDontRemoveTimeoutHours         float64
+	StorageDriver                     string  // "sqlite" or "postgres"
+	PostgresDSN                       string  `json:"-"` // Contains password, so it is never printed
+	BackupIntervalHours               float64 // Interval of SQLite database backups. 0 - backups are disabled
+	BackupKeepCount                   int     // Number of kept backups, older ones are deleted
+	AdminAPIAddress                   string  // Address of admin HTTP API, e.g. "127.0.0.1:8081". Empty - API is disabled
+	AdminAPIToken                     string  `json:"-"` // Bearer token of admin HTTP API
 }
 
-// Load configuration
-func LoadConfig(configPath string) (cfg Config, err error) {
+// Load configuration.
+// All invalid values are reported together in the returned error.
+// Unknown sections and keys do not fail loading, they are returned as warnings
+func LoadConfig(configPath string) (cfg Config, warnings []string, err error) {
 	cfgFile, err := ini.Load(configPath)
 	if err != nil {
 		return
 	}
 
-	err = loadBotSection(cfgFile, &cfg)
-	loadLogSection(cfgFile, &cfg)
-	loadTimeSectiong(cfgFile, &cfg)
+	loader := newSectionsLoader(cfgFile)
+
+	loadBotSection(loader, &cfg)
+	loadLogSection(loader, &cfg)
+	loadTimeSectiong(loader, &cfg)
+	loadStorageSection(loader, &cfg)
+	loadBackupSection(loader, &cfg)
+	loadAdminAPISection(loader, &cfg)
 
+	warnings = loader.unknownKeysWarnings()
+
+	// Values that failed to parse are replaced by defaults, so ranges are checked anyway
+	err = errors.Join(append(loader.errs, cfg.Validate())...)
 	return
 }
 
 // Load [Bot] Section
-func loadBotSection(cfgFile *ini.File, cfg *Config) (err error) {
-	botSection := cfgFile.Section("Bot")
+func loadBotSection(loader *sectionsLoader, cfg *Config) {
+	botSection := loader.section("Bot")
 
-	cfg.IsRemoveCommandsAfterExit, _ = botSection.Key("IsRemoveCommandsAfterExit").Bool()
+	cfg.IsRemoveCommandsAfterExit = loader.boolKey(botSection, "IsRemoveCommandsAfterExit", false)
 
-	botTokenStr := botSection.Key("BotToken").String()
+	botTokenStr := loader.stringKey(botSection, "BotToken", "")
 	// check if bot token exists
 	if botTokenStr == "" {
-		return fmt.Errorf("failed to read BotToken from config")
+		loader.errs = append(loader.errs, fmt.Errorf("failed to read BotToken from config"))
+	} else {
+		cfg.BotToken = "Bot " + botTokenStr
 	}
-	cfg.BotToken = "Bot " + botSection.Key("BotToken").String()
 
-	removeBatchSize, err := botSection.Key("RemoveBatchSize").Int()
-	if err != nil {
-		removeBatchSize = 30
-	}
-	cfg.RemoveBatchSize = removeBatchSize
+	cfg.RemoveBatchSize = loader.intKey(botSection, "RemoveBatchSize", 30)
+
+	cfg.CommandsScope = loader.stringKey(botSection, "CommandsScope", CommandsScopeGlobal)
+	cfg.DevGuildIDs = loader.stringListKey(botSection, "DevGuildIDs")
 
-	return nil
+	cfg.ShardCount = loader.intKey(botSection, "ShardCount", 0)
+	cfg.ShardIDs = loader.intListKey(botSection, "ShardIDs")
 }
 
 // Load [Log] Section
-func loadLogSection(cfgFile *ini.File, cfg *Config) {
-	loggingSection := cfgFile.Section("Logging")
+func loadLogSection(loader *sectionsLoader, cfg *Config) {
+	loggingSection := loader.section("Logging")
 
-	cfg.IsLogToFile, _ = loggingSection.Key("IsLogToFile").Bool()
+	cfg.IsLogToFile = loader.boolKey(loggingSection, "IsLogToFile", false)
 }
 
 // Load [Time] Section
-func loadTimeSectiong(cfgFile *ini.File, cfg *Config) {
-	hoursSection := cfgFile.Section("Time")
+func loadTimeSectiong(loader *sectionsLoader, cfg *Config) {
+	hoursSection := loader.section("Time")
 
-	var err error
+	cfg.RemoveInactiveChannelTimeoutHours = loader.float64Key(hoursSection, "RemoveInactiveChannelTimeoutHours", 8760) // 1 year
+	cfg.MaximumOutdateHoursValue = loader.float64Key(hoursSection, "MaximumOutdateHoursValue", 720)                    // 1 month
+	cfg.MinimaOutdatelHoursValue = loader.float64Key(hoursSection, "MinimalOutdateHoursValue", 0.15)                   // 9 minutes
+	cfg.OldDontRemoveTimeoutHours = loader.float64Key(hoursSection, "OldDontRemoveTimeoutHours", 335)                  // 14 days
+}
 
-	cfg.RemoveInactiveChannelTimeoutHours, err = hoursSection.Key("RemoveInactiveChannelTimeoutHours").Float64()
-	if err != nil {
-		cfg.RemoveInactiveChannelTimeoutHours = 8760 // 1 year
-	}
+// Load [Storage] Section
+func loadStorageSection(loader *sectionsLoader, cfg *Config) {
+	storageSection := loader.section("Storage")
 
-	cfg.MaximumOutdateHoursValue, err = hoursSection.Key("MaximumOutdateHoursValue").Float64()
-	if err != nil {
-		cfg.MaximumOutdateHoursValue = 720 // 1 month
-	}
+	cfg.StorageDriver = loader.stringKey(storageSection, "Driver", "sqlite")
+	cfg.PostgresDSN = loader.stringKey(storageSection, "PostgresDSN", "")
+}
 
-	cfg.MinimaOutdatelHoursValue, err = hoursSection.Key("MinimalOutdateHoursValue").Float64()
-	if err != nil {
-		cfg.MinimaOutdatelHoursValue = 0.15 // 9 minutes
-	}
+// Load [Backup] Section
+func loadBackupSection(loader *sectionsLoader, cfg *Config) {
+	backupSection := loader.section("Backup")
 
-	cfg.OldDontRemoveTimeoutHours, err = hoursSection.Key("OldDontRemoveTimeoutHours").Float64()
-	if err != nil {
-		cfg.OldDontRemoveTimeoutHours = 335 // 14 days
-	}
+	cfg.BackupIntervalHours = loader.float64Key(backupSection, "IntervalHours", 24)
+	cfg.BackupKeepCount = loader.intKey(backupSection, "KeepCount", 7)
+}
+
+// Load [AdminAPI] Section
+func loadAdminAPISection(loader *sectionsLoader, cfg *Config) {
+	adminAPISection := loader.section("AdminAPI")
+
+	cfg.AdminAPIAddress = loader.stringKey(adminAPISection, "Address", "")
+	cfg.AdminAPIToken = loader.stringKey(adminAPISection, "Token", "")
 }
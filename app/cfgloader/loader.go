@@ -0,0 +1,136 @@
+package cfgloader
+
+// Typed reading of ini keys with error collection
+
+import (
+	"fmt"
+
+	"gopkg.in/ini.v1"
+)
+
+// Reads sections and keys of the config file.
+// Remembers every requested key to find unknown ones and collects all parse errors
+type sectionsLoader struct {
+	file      *ini.File
+	knownKeys map[string]map[string]bool // Section name -> key names that were requested
+	errs      []error                    // Errors of parsing values
+}
+
+func newSectionsLoader(file *ini.File) *sectionsLoader {
+	return &sectionsLoader{
+		file:      file,
+		knownKeys: map[string]map[string]bool{},
+	}
+}
+
+// Get section and mark it as known
+func (loader *sectionsLoader) section(name string) *ini.Section {
+	if _, ok := loader.knownKeys[name]; !ok {
+		loader.knownKeys[name] = map[string]bool{}
+	}
+	return loader.file.Section(name)
+}
+
+// Mark key as known. Returns false if key is not set in the section
+func (loader *sectionsLoader) useKey(section *ini.Section, name string) (isSet bool) {
+	loader.knownKeys[section.Name()][name] = true
+	return section.HasKey(name)
+}
+
+// Read string key. Default value is used if key is not set
+func (loader *sectionsLoader) stringKey(section *ini.Section, name string, defaultValue string) string {
+	if !loader.useKey(section, name) {
+		return defaultValue
+	}
+	return section.Key(name).String()
+}
+
+// Read comma separated list key. Empty if key is not set
+func (loader *sectionsLoader) stringListKey(section *ini.Section, name string) []string {
+	if !loader.useKey(section, name) {
+		return nil
+	}
+	return section.Key(name).Strings(",")
+}
+
+// Read comma separated list of integers key. Empty if key is not set
+func (loader *sectionsLoader) intListKey(section *ini.Section, name string) []int {
+	if !loader.useKey(section, name) {
+		return nil
+	}
+
+	values, err := section.Key(name).StrictInts(",")
+	if err != nil {
+		loader.addKeyError(section, name, "list of integers")
+		return nil
+	}
+	return values
+}
+
+// Read bool key. Default value is used if key is not set
+func (loader *sectionsLoader) boolKey(section *ini.Section, name string, defaultValue bool) bool {
+	if !loader.useKey(section, name) {
+		return defaultValue
+	}
+
+	value, err := section.Key(name).Bool()
+	if err != nil {
+		loader.addKeyError(section, name, "bool")
+		return defaultValue
+	}
+	return value
+}
+
+// Read int key. Default value is used if key is not set
+func (loader *sectionsLoader) intKey(section *ini.Section, name string, defaultValue int) int {
+	if !loader.useKey(section, name) {
+		return defaultValue
+	}
+
+	value, err := section.Key(name).Int()
+	if err != nil {
+		loader.addKeyError(section, name, "integer")
+		return defaultValue
+	}
+	return value
+}
+
+// Read float key. Default value is used if key is not set
+func (loader *sectionsLoader) float64Key(section *ini.Section, name string, defaultValue float64) float64 {
+	if !loader.useKey(section, name) {
+		return defaultValue
+	}
+
+	value, err := section.Key(name).Float64()
+	if err != nil {
+		loader.addKeyError(section, name, "number")
+		return defaultValue
+	}
+	return value
+}
+
+func (loader *sectionsLoader) addKeyError(section *ini.Section, name string, expectedType string) {
+	err := fmt.Errorf("[%s] %s: %q is not a valid %s", section.Name(), name, section.Key(name).String(), expectedType)
+	loader.errs = append(loader.errs, err)
+}
+
+// Get warnings about sections and keys that were never requested (typos, outdated options)
+func (loader *sectionsLoader) unknownKeysWarnings() (warnings []string) {
+	for _, section := range loader.file.Sections() {
+		knownKeys, isKnownSection := loader.knownKeys[section.Name()]
+
+		// Default section always exists. It only matters if keys are written outside of any section
+		if !isKnownSection && section.Name() != ini.DefaultSection {
+			warnings = append(warnings, fmt.Sprintf("unknown section [%s]", section.Name()))
+			continue
+		}
+
+		for _, keyName := range section.KeyStrings() {
+			if !knownKeys[keyName] {
+				warnings = append(warnings, fmt.Sprintf("unknown key %s in section [%s]", keyName, section.Name()))
+			}
+		}
+	}
+
+	return warnings
+}
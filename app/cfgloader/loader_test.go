@@ -0,0 +1,73 @@
+package cfgloader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Write config file in the test directory
+func writeTestConfigFile(t *testing.T, content string) (configPath string) {
+	t.Helper()
+
+	configPath = filepath.Join(t.TempDir(), "config.ini")
+	err := os.WriteFile(configPath, []byte(content), 0666)
+	if err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return configPath
+}
+
+// Unknown keys and sections are reported as warnings, config is still loaded
+func TestLoadConfigUnknownKey(t *testing.T) {
+	configPath := writeTestConfigFile(t, `
+[Bot]
+BotToken = token
+RemoveBachSize = 10
+
+[Unknown]
+Key = value
+`)
+
+	cfg, warnings, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if cfg.BotToken != "Bot token" || cfg.RemoveBatchSize != 30 {
+		t.Errorf("Loaded config has BotToken %q and RemoveBatchSize %d, want defaults", cfg.BotToken, cfg.RemoveBatchSize)
+	}
+
+	joinedWarnings := strings.Join(warnings, "\n")
+	if len(warnings) != 2 || !strings.Contains(joinedWarnings, "RemoveBachSize") || !strings.Contains(joinedWarnings, "[Unknown]") {
+		t.Errorf("LoadConfig warnings = %q, want unknown key RemoveBachSize and unknown section [Unknown]", warnings)
+	}
+}
+
+// Invalid values of all sections are reported by one error
+func TestLoadConfigReportsAllErrors(t *testing.T) {
+	configPath := writeTestConfigFile(t, `
+[Bot]
+BotToken = token
+RemoveBatchSize = many
+
+[Time]
+MinimalOutdateHoursValue = 0
+
+[Storage]
+Driver = mysql
+
+[Backup]
+KeepCount = 0
+`)
+
+	_, _, err := LoadConfig(configPath)
+	if err == nil {
+		t.Fatal("LoadConfig of invalid config returned no error")
+	}
+	for _, key := range []string{"RemoveBatchSize", "MinimalOutdateHoursValue", "Driver", "KeepCount"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("LoadConfig error doesn't mention %s:\n%v", key, err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package cfgloader
+
+// Checking ranges and relations of config values
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	maxDiscordBatchSize       = 100 // Discord returns and bulk deletes at most 100 messages per request
+	maxBulkDeleteTimeoutHours = 336 // Discord doesn't allow to bulk delete messages older than 14 days
+)
+
+// Check that config values are in allowed ranges.
+// All problems are reported together
+func (cfg *Config) Validate() error {
+	var errs []error
+
+	if cfg.RemoveBatchSize < 1 || cfg.RemoveBatchSize > maxDiscordBatchSize {
+		errs = append(errs, fmt.Errorf("[Bot] RemoveBatchSize: must be between 1 and %d, got %d", maxDiscordBatchSize, cfg.RemoveBatchSize))
+	}
+
+	switch cfg.CommandsScope {
+	case CommandsScopeGlobal:
+	case CommandsScopeGuilds:
+		if len(cfg.DevGuildIDs) == 0 {
+			errs = append(errs, fmt.Errorf("[Bot] DevGuildIDs: required for %s commands scope", CommandsScopeGuilds))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("[Bot] CommandsScope: must be %s or %s, got %q", CommandsScopeGlobal, CommandsScopeGuilds, cfg.CommandsScope))
+	}
+
+	if cfg.ShardCount < 0 {
+		errs = append(errs, fmt.Errorf("[Bot] ShardCount: must not be negative, got %d", cfg.ShardCount))
+	}
+	for _, shardID := range cfg.ShardIDs {
+		// Shard IDs of auto shard count are checked after the count is received from Discord
+		if shardID < 0 || (cfg.ShardCount > 0 && shardID >= cfg.ShardCount) {
+			errs = append(errs, fmt.Errorf("[Bot] ShardIDs: %d is out of range of ShardCount %d", shardID, cfg.ShardCount))
+		}
+	}
+
+	if cfg.MinimaOutdatelHoursValue <= 0 {
+		errs = append(errs, fmt.Errorf("[Time] MinimalOutdateHoursValue: must be positive, got %v", cfg.MinimaOutdatelHoursValue))
+	}
+	if cfg.MaximumOutdateHoursValue <= 0 {
+		errs = append(errs, fmt.Errorf("[Time] MaximumOutdateHoursValue: must be positive, got %v", cfg.MaximumOutdateHoursValue))
+	}
+	if cfg.MinimaOutdatelHoursValue > cfg.MaximumOutdateHoursValue {
+		errs = append(errs, fmt.Errorf("[Time] MinimalOutdateHoursValue (%v) must not be greater than MaximumOutdateHoursValue (%v)",
+			cfg.MinimaOutdatelHoursValue, cfg.MaximumOutdateHoursValue))
+	}
+
+	if cfg.RemoveInactiveChannelTimeoutHours <= 0 {
+		errs = append(errs, fmt.Errorf("[Time] RemoveInactiveChannelTimeoutHours: must be positive, got %v", cfg.RemoveInactiveChannelTimeoutHours))
+	}
+
+	if cfg.OldDontRemoveTimeoutHours <= 0 || cfg.OldDontRemoveTimeoutHours > maxBulkDeleteTimeoutHours {
+		errs = append(errs, fmt.Errorf("[Time] OldDontRemoveTimeoutHours: must be between 0 and %d, got %v", maxBulkDeleteTimeoutHours, cfg.OldDontRemoveTimeoutHours))
+	}
+
+	switch cfg.StorageDriver {
+	case "sqlite":
+		// Database file can't be shared, so processes running other shards would have their own channels
+		if !cfg.isAllShardsRun() {
+			errs = append(errs, fmt.Errorf("[Storage] Driver: sqlite requires ShardIDs to be empty or list all ShardCount shards, use postgres to spread shards over processes"))
+		}
+	case "postgres":
+		if cfg.PostgresDSN == "" {
+			errs = append(errs, fmt.Errorf("[Storage] PostgresDSN: required for postgres driver"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("[Storage] Driver: must be sqlite or postgres, got %q", cfg.StorageDriver))
+	}
+
+	if cfg.BackupIntervalHours < 0 {
+		errs = append(errs, fmt.Errorf("[Backup] IntervalHours: must not be negative, got %v", cfg.BackupIntervalHours))
+	}
+	if cfg.BackupKeepCount < 1 {
+		errs = append(errs, fmt.Errorf("[Backup] KeepCount: must be at least 1, got %d", cfg.BackupKeepCount))
+	}
+
+	if cfg.AdminAPIAddress != "" && cfg.AdminAPIToken == "" {
+		errs = append(errs, fmt.Errorf("[AdminAPI] Token: required if Address is set"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Check if this process runs all shards. Unknown number of shards is covered only by empty ShardIDs
+func (cfg *Config) isAllShardsRun() bool {
+	if len(cfg.ShardIDs) == 0 {
+		return true
+	} else if cfg.ShardCount == 0 {
+		return false
+	}
+
+	for shardID := range cfg.ShardCount {
+		if !slices.Contains(cfg.ShardIDs, shardID) {
+			return false
+		}
+	}
+	return true
+}
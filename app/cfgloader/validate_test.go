@@ -0,0 +1,89 @@
+package cfgloader
+
+import "testing"
+
+// Valid config with sqlite storage
+func newTestConfig() Config {
+	return Config{
+		CommandsScope:                     CommandsScopeGlobal,
+		MinimaOutdatelHoursValue:          0.1,
+		MaximumOutdateHoursValue:          1000,
+		RemoveInactiveChannelTimeoutHours: 1000,
+		RemoveBatchSize:                   30,
+		OldDontRemoveTimeoutHours:         335,
+		StorageDriver:                     "sqlite",
+		BackupKeepCount:                   7,
+	}
+}
+
+func TestValidateShardsOfStorage(t *testing.T) {
+	tests := []struct {
+		driver     string
+		shardCount int
+		shardIDs   []int
+		isValid    bool
+	}{
+		{driver: "sqlite", isValid: true},
+		{driver: "sqlite", shardCount: 4, isValid: true},
+		{driver: "sqlite", shardCount: 2, shardIDs: []int{1, 0}, isValid: true},
+		{driver: "sqlite", shardCount: 4, shardIDs: []int{0, 1}, isValid: false},
+		{driver: "sqlite", shardCount: 2, shardIDs: []int{0, 0}, isValid: false},
+		{driver: "sqlite", shardIDs: []int{0}, isValid: false},
+		{driver: "postgres", shardCount: 4, shardIDs: []int{0, 1}, isValid: true},
+		{driver: "postgres", shardIDs: []int{0}, isValid: true},
+	}
+
+	for _, test := range tests {
+		cfg := newTestConfig()
+		cfg.StorageDriver = test.driver
+		cfg.PostgresDSN = "postgres://localhost/bot"
+		cfg.ShardCount = test.shardCount
+		cfg.ShardIDs = test.shardIDs
+
+		err := cfg.Validate()
+		if (err == nil) != test.isValid {
+			t.Errorf("Validate of %s with ShardCount %d and ShardIDs %v returned %v, want valid %t",
+				test.driver, test.shardCount, test.shardIDs, err, test.isValid)
+		}
+	}
+}
+
+func TestValidateTimeoutBounds(t *testing.T) {
+	tests := []struct {
+		minimalHours, maximumHours float64
+		isValid                    bool
+	}{
+		{minimalHours: 0.1, maximumHours: 1000, isValid: true},
+		{minimalHours: 5, maximumHours: 5, isValid: true},
+		{minimalHours: 0, maximumHours: 1000, isValid: false},
+		{minimalHours: -1, maximumHours: 1000, isValid: false},
+		{minimalHours: 0.1, maximumHours: 0, isValid: false},
+		{minimalHours: 10, maximumHours: 5, isValid: false},
+	}
+
+	for _, test := range tests {
+		cfg := newTestConfig()
+		cfg.MinimaOutdatelHoursValue = test.minimalHours
+		cfg.MaximumOutdateHoursValue = test.maximumHours
+
+		err := cfg.Validate()
+		if (err == nil) != test.isValid {
+			t.Errorf("Validate with timeout bounds %v..%v returned %v, want valid %t",
+				test.minimalHours, test.maximumHours, err, test.isValid)
+		}
+	}
+}
+
+// Every invalid value is reported, not only the first one
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.RemoveBatchSize = 0
+	cfg.MinimaOutdatelHoursValue = 0
+	cfg.StorageDriver = "mysql"
+
+	err := cfg.Validate()
+	joinedErr, ok := err.(interface{ Unwrap() []error })
+	if !ok || len(joinedErr.Unwrap()) != 3 {
+		t.Fatalf("Validate of config with 3 invalid values returned %v, want 3 joined errors", err)
+	}
+}
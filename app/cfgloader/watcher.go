@@ -0,0 +1,133 @@
+package cfgloader
+
+// Hot-reload of configuration
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Keeps the current config snapshot and reloads it when the config file changes or SIGHUP is received.
+// Snapshots are never modified after publishing, so they can be read without locks
+type Watcher struct {
+	path     string
+	current  atomic.Pointer[Config]
+	modTime  time.Time                    // Modification time of the config file at last load
+	onReload func(oldCfg, newCfg *Config) // Called after new snapshot is published
+}
+
+// Create watcher with already loaded config
+func NewWatcher(configPath string, cfg Config) *Watcher {
+	watcher := &Watcher{path: configPath}
+	watcher.current.Store(&cfg)
+
+	if fileInfo, err := os.Stat(configPath); err == nil {
+		watcher.modTime = fileInfo.ModTime()
+	}
+
+	return watcher
+}
+
+// Get current config snapshot
+func (watcher *Watcher) Config() *Config {
+	return watcher.current.Load()
+}
+
+// Set function that is called after each successful reload. Must be set before Run
+func (watcher *Watcher) OnReload(handler func(oldCfg, newCfg *Config)) {
+	watcher.onReload = handler
+}
+
+// Check config file every interval and reload it on change or SIGHUP. Blocks forever
+func (watcher *Watcher) Run(checkInterval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hangup:
+			log.Println("SIGHUP received, reloading config")
+			watcher.reload()
+		case <-ticker.C:
+			if watcher.isFileChanged() {
+				log.Println("Config file changed, reloading config")
+				watcher.reload()
+			}
+		}
+	}
+}
+
+// Check if config file was modified since last load
+func (watcher *Watcher) isFileChanged() bool {
+	fileInfo, err := os.Stat(watcher.path)
+	if err != nil {
+		return false
+	}
+	return !fileInfo.ModTime().Equal(watcher.modTime)
+}
+
+// Load and validate config file and publish it as new snapshot.
+// Invalid config is rejected, the previous snapshot stays in use
+func (watcher *Watcher) reload() {
+	if fileInfo, err := os.Stat(watcher.path); err == nil {
+		watcher.modTime = fileInfo.ModTime()
+	}
+
+	newCfg, warnings, err := LoadConfig(watcher.path)
+	for _, warning := range warnings {
+		log.Printf("Config warning: %s", warning)
+	}
+	if err != nil {
+		log.Printf("New config is rejected, keeping previous one:\n%v", err)
+		return
+	}
+
+	oldCfg := watcher.Config()
+	keepRestartRequiredOptions(oldCfg, &newCfg)
+
+	watcher.current.Store(&newCfg)
+	log.Println("Config reloaded")
+
+	if watcher.onReload != nil {
+		watcher.onReload(oldCfg, &newCfg)
+	}
+}
+
+// Options used only at startup can't be changed without restart.
+// Their old values are kept in new snapshot so it reflects the running state
+func keepRestartRequiredOptions(oldCfg *Config, newCfg *Config) {
+	if newCfg.BotToken != oldCfg.BotToken {
+		log.Println("Config warning: BotToken change requires restart")
+		newCfg.BotToken = oldCfg.BotToken
+	}
+	if newCfg.ShardCount != oldCfg.ShardCount || !slices.Equal(newCfg.ShardIDs, oldCfg.ShardIDs) {
+		log.Println("Config warning: ShardCount and ShardIDs change requires restart")
+		newCfg.ShardCount = oldCfg.ShardCount
+		newCfg.ShardIDs = oldCfg.ShardIDs
+	}
+	if newCfg.IsLogToFile != oldCfg.IsLogToFile {
+		log.Println("Config warning: IsLogToFile change requires restart")
+		newCfg.IsLogToFile = oldCfg.IsLogToFile
+	}
+	if newCfg.IsRemoveCommandsAfterExit != oldCfg.IsRemoveCommandsAfterExit {
+		log.Println("Config warning: IsRemoveCommandsAfterExit change requires restart")
+		newCfg.IsRemoveCommandsAfterExit = oldCfg.IsRemoveCommandsAfterExit
+	}
+	if newCfg.AdminAPIAddress != oldCfg.AdminAPIAddress {
+		log.Println("Config warning: AdminAPI Address change requires restart")
+		newCfg.AdminAPIAddress = oldCfg.AdminAPIAddress
+	}
+	if newCfg.StorageDriver != oldCfg.StorageDriver || newCfg.PostgresDSN != oldCfg.PostgresDSN {
+		log.Println("Config warning: Storage section change requires restart")
+		newCfg.StorageDriver = oldCfg.StorageDriver
+		newCfg.PostgresDSN = oldCfg.PostgresDSN
+	}
+}
@@ -3,64 +3,288 @@ package main
 // Commands
 
 import (
+	"bytes"
+	"encoding/json"
 	"log"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cfgloader"
 )
 
-var commands []*discordgo.ApplicationCommand
+var (
+	commands []*discordgo.ApplicationCommand
+
+	isAllowedInDM            = false
+	manageMessagesPermission = int64(discordgo.PermissionManageMessages)
+	manageGuildPermission    = int64(discordgo.PermissionManageServer)
+	minimalDurationHours     = 1.0 / 60   // 1 minute
+	maximalDurationHours     = 365 * 24.0 // 1 year. Limit of durations that are not limited by config
+	minimalPurgeLimit        = 1.0
+)
 
 func initCommands() {
+	// Limits are shown in descriptions, so commands are updated when limits are changed in config
+	minTimeoutHours, maxTimeoutHours := getDurationLimits("set-timeout")
+
 	commands = []*discordgo.ApplicationCommand{
 		{
-			Name:        "info-timeout",
-			Description: "Shows timeout set in the channel",
+			Name: "info-timeout",
+			Options: []*discordgo.ApplicationCommandOption{
+				newTargetChannelOption(),
+			},
 		},
 		{
-			Name:        "remove-timeout",
-			Description: "Stop removing message int channel",
+			Name: "remove-timeout",
+			Options: []*discordgo.ApplicationCommandOption{
+				newTargetChannelOption(),
+			},
 		},
 		{
-			Name:        "set-timeout",
-			Description: "Bot deletes messages older than specified hours in the channel",
+			Name: "set-timeout",
 			Options: []*discordgo.ApplicationCommandOption{
+				newDurationOption("duration", true),
+				newTargetChannelOption(),
+				{
+					Type: discordgo.ApplicationCommandOptionBoolean,
+					Name: "precise",
+				},
 				{
-					Type:        discordgo.ApplicationCommandOptionNumber,
-					Name:        "hours",
-					Description: "message lifetime in hours",
-					MinValue:    &Config.MinimaOutdatelHoursValue,
-					MaxValue:    Config.MaximumOutdateHoursValue,
-					Required:    true,
+					Type: discordgo.ApplicationCommandOptionBoolean,
+					Name: "archive-threads",
 				},
 			},
 		},
+		{
+			Name: "pause-timeout",
+			Options: []*discordgo.ApplicationCommandOption{
+				newDurationOption("duration", false),
+				newTargetChannelOption(),
+			},
+		},
+		{
+			Name: "resume-timeout",
+			Options: []*discordgo.ApplicationCommandOption{
+				newTargetChannelOption(),
+			},
+		},
+		{
+			Name: "purge-now",
+			Options: []*discordgo.ApplicationCommandOption{
+				newDurationOption("older-than", false),
+				{
+					Type:     discordgo.ApplicationCommandOptionInteger,
+					Name:     "limit",
+					MinValue: &minimalPurgeLimit,
+				},
+				{
+					Type: discordgo.ApplicationCommandOptionUser,
+					Name: "user",
+				},
+			},
+		},
+		{
+			Name: "my-timeout",
+			Options: []*discordgo.ApplicationCommandOption{
+				newDurationOption("duration", false),
+			},
+		},
+		{
+			Name: "set-user-timeout",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:     discordgo.ApplicationCommandOptionUser,
+					Name:     "user",
+					Required: true,
+				},
+				newDurationOption("duration", false),
+				newTargetChannelOption(),
+			},
+		},
+		{
+			Name:                     "list-timeouts",
+			DMPermission:             &isAllowedInDM,
+			DefaultMemberPermissions: &manageMessagesPermission,
+		},
+		{
+			Name:                     "export-config",
+			DMPermission:             &isAllowedInDM,
+			DefaultMemberPermissions: &manageGuildPermission,
+		},
+		{
+			Name:                     "set-language",
+			DMPermission:             &isAllowedInDM,
+			DefaultMemberPermissions: &manageGuildPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				newLanguageOption(),
+			},
+		},
+	}
+
+	localizeCommands(commands, map[string][]any{
+		"command.set-timeout.option.duration.description": {
+			сonvertFloatHoursToTimeString(minTimeoutHours),
+			сonvertFloatHoursToTimeString(maxTimeoutHours),
+		},
+	})
+}
+
+// Get guilds to register commands in by config. Empty guild ID means global commands
+func getCommandsGuildIDs(config *cfgloader.Config) []string {
+	if config.CommandsScope == cfgloader.CommandsScopeGuilds {
+		return config.DevGuildIDs
 	}
+	return []string{""}
 }
 
-// Register commands in the bot (and local)
-func RegisterCommands() (registeredCommands []*discordgo.ApplicationCommand) {
+// Sync registered commands with current definitions in every guild of commands scope.
+// Commands are overwritten only if some definitions differ, so restarts don't touch commands
+func SyncCommands() {
 	initCommands()
-	log.Println("Registering commands...")
+	log.Println("Syncing commands...")
 
-	for _, command := range commands {
-		registered_command, err := Session.ApplicationCommandCreate(Session.State.User.ID, Config.GuildID, command)
+	for _, guildID := range getCommandsGuildIDs(currentConfig()) {
+		err := syncGuildCommands(guildID, commands)
 		if err != nil {
-			log.Printf("Cannot create '%v' command: %v", command.Name, err)
+			log.Printf("Cannot sync commands (guild '%s'): %v", guildID, err)
 		}
-		registeredCommands = append(registeredCommands, registered_command)
 	}
-
-	return
 }
 
-// Remove (unregisted) commands in the bot
-func RemoveCommands(commandsForRemoving []*discordgo.ApplicationCommand) {
+// Remove (unregister) commands of the bot in every guild of commands scope
+func RemoveCommands() {
 	log.Println("Removing commands...")
 
-	for _, command := range commandsForRemoving {
-		err := Session.ApplicationCommandDelete(Session.State.User.ID, Config.GuildID, command.ID)
-		if err != nil {
-			log.Printf("Cannot delete '%v' command: %v", command.Name, err)
+	for _, guildID := range getCommandsGuildIDs(currentConfig()) {
+		RemoveGuildCommands(guildID)
+	}
+}
+
+// Remove (unregister) commands of the bot in the guild. Empty guild ID - global commands
+func RemoveGuildCommands(guildID string) {
+	_, err := Session.ApplicationCommandBulkOverwrite(Session.State.User.ID, guildID, []*discordgo.ApplicationCommand{})
+	if err != nil {
+		log.Printf("Cannot remove commands (guild '%s'): %v", guildID, err)
+	}
+}
+
+// Overwrite commands of the guild if registered definitions differ from the specified ones
+func syncGuildCommands(guildID string, commands []*discordgo.ApplicationCommand) (err error) {
+	registeredCommands, err := Session.ApplicationCommands(Session.State.User.ID, guildID)
+	if err != nil {
+		return err
+	}
+
+	registeredByName := map[string]*discordgo.ApplicationCommand{}
+	for _, registeredCommand := range registeredCommands {
+		registeredByName[registeredCommand.Name] = registeredCommand
+	}
+
+	var created, updated, deleted []string
+	for _, command := range commands {
+		registeredCommand, ok := registeredByName[command.Name]
+		if !ok {
+			created = append(created, command.Name)
+		} else if !isSameCommand(command, registeredCommand, guildID != "") {
+			updated = append(updated, command.Name)
 		}
+		delete(registeredByName, command.Name)
+	}
+	for name := range registeredByName {
+		deleted = append(deleted, name)
+	}
+
+	if len(created) == 0 && len(updated) == 0 && len(deleted) == 0 {
+		log.Printf("Commands are up to date (guild '%s')", guildID)
+		return nil
+	}
+
+	// Discord keeps IDs of commands that already exist, so only changed commands are affected
+	_, err = Session.ApplicationCommandBulkOverwrite(Session.State.User.ID, guildID, commands)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Commands synced (guild '%s'): created %v, updated %v, deleted %v", guildID, created, updated, deleted)
+	return nil
+}
+
+// Compare command definitions ignoring fields set by Discord and defaults that Discord fills in
+func isSameCommand(command *discordgo.ApplicationCommand, registeredCommand *discordgo.ApplicationCommand, isGuildCommand bool) bool {
+	commandJSON, err := json.Marshal(normalizeCommand(command, isGuildCommand))
+	if err != nil {
+		return false
+	}
+	registeredCommandJSON, err := json.Marshal(normalizeCommand(registeredCommand, isGuildCommand))
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(commandJSON, registeredCommandJSON)
+}
+
+// Get copy of command definition in comparable form
+func normalizeCommand(command *discordgo.ApplicationCommand, isGuildCommand bool) *discordgo.ApplicationCommand {
+	isTrue, isFalse := true, false
+
+	normalized := &discordgo.ApplicationCommand{
+		Type:                     command.Type,
+		Name:                     command.Name,
+		NameLocalizations:        normalizeLocalizationsPointer(command.NameLocalizations),
+		DefaultMemberPermissions: command.DefaultMemberPermissions,
+		DMPermission:             command.DMPermission,
+		NSFW:                     command.NSFW,
+		Description:              command.Description,
+		DescriptionLocalizations: normalizeLocalizationsPointer(command.DescriptionLocalizations),
+		Options:                  normalizeOptions(command.Options),
+	}
+
+	if normalized.Type == 0 {
+		normalized.Type = discordgo.ChatApplicationCommand
+	}
+	if normalized.NSFW == nil {
+		normalized.NSFW = &isFalse
+	}
+	// DM permission has no effect for guild commands
+	if isGuildCommand {
+		normalized.DMPermission = nil
+	} else if normalized.DMPermission == nil {
+		normalized.DMPermission = &isTrue
+	}
+
+	return normalized
+}
+
+// Get copy of options in comparable form
+func normalizeOptions(options []*discordgo.ApplicationCommandOption) []*discordgo.ApplicationCommandOption {
+	normalized := []*discordgo.ApplicationCommandOption{}
+	for _, option := range options {
+		normalizedOption := *option
+		normalizedOption.NameLocalizations = normalizeLocalizations(option.NameLocalizations)
+		normalizedOption.DescriptionLocalizations = normalizeLocalizations(option.DescriptionLocalizations)
+		normalizedOption.Options = normalizeOptions(option.Options)
+
+		if normalizedOption.ChannelTypes == nil {
+			normalizedOption.ChannelTypes = []discordgo.ChannelType{}
+		}
+		if normalizedOption.Choices == nil {
+			normalizedOption.Choices = []*discordgo.ApplicationCommandOptionChoice{}
+		}
+
+		normalized = append(normalized, &normalizedOption)
+	}
+	return normalized
+}
+
+// Empty localizations are the same as absent ones
+func normalizeLocalizations(localizations map[discordgo.Locale]string) map[discordgo.Locale]string {
+	if len(localizations) == 0 {
+		return nil
+	}
+	return localizations
+}
+
+func normalizeLocalizationsPointer(localizations *map[discordgo.Locale]string) *map[discordgo.Locale]string {
+	if localizations == nil || len(*localizations) == 0 {
+		return nil
 	}
+	return localizations
 }
@@ -0,0 +1,69 @@
+package cpstorage
+
+// Audit log of changes of channels settings
+
+import (
+	"strings"
+)
+
+type AuditEntryEntity struct {
+	ID        int64  `db:"id"`         // Entry ID. Increases with time
+	DateUnix  int64  `db:"date"`       // Date (unixtime) of the change
+	GuildID   string `db:"guild_id"`   // Guild of the changed channel. Empty if unknown
+	ChannelID string `db:"channel_id"` // Changed channel. Empty for guild settings
+	Actor     string `db:"actor"`      // Who made the change: "user:<id>" or "api"
+	Action    string `db:"action"`     // Name of the change, e.g. "set-timeout"
+	Details   string `db:"details"`    // Human readable parameters of the change
+}
+
+// Filter of audit entries. Empty fields are not used
+type AuditFilter struct {
+	GuildID   string
+	ChannelID string
+	BeforeID  int64 // Only entries older than this entry. Used for pagination
+	Limit     int   // Maximum number of entries
+}
+
+// Save audit entry
+func (s *sqlStore) WriteAuditEntry(auditEntry *AuditEntryEntity) (err error) {
+	query := `
+		INSERT INTO audit_log
+			(date, guild_id, channel_id, actor, action, details)
+			VALUES (?, ?, ?, ?, ?, ?)
+	`
+	_, err = s.db.Exec(s.db.Rebind(query),
+		auditEntry.DateUnix, auditEntry.GuildID, auditEntry.ChannelID, auditEntry.Actor, auditEntry.Action, auditEntry.Details)
+	return
+}
+
+// Get audit entries matching filter, from the newest
+func (s *sqlStore) GetAuditEntries(filter AuditFilter) (auditEntries []*AuditEntryEntity, err error) {
+	var conditions []string
+	var args []any
+	if filter.GuildID != "" {
+		conditions = append(conditions, "guild_id = ?")
+		args = append(args, filter.GuildID)
+	}
+	if filter.ChannelID != "" {
+		conditions = append(conditions, "channel_id = ?")
+		args = append(args, filter.ChannelID)
+	}
+	if filter.BeforeID > 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.BeforeID)
+	}
+
+	query := "SELECT * FROM audit_log"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	auditEntries = []*AuditEntryEntity{}
+	err = s.db.Select(&auditEntries, s.db.Rebind(query), args...)
+	return
+}
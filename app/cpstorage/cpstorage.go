@@ -5,18 +5,23 @@ package cpstorage
 // Inititalization and params
 
 import (
-	"database/sql"
+	"errors"
+	"fmt"
 	"log"
-	"sync"
+	"math"
+)
+
+const (
+	DriverSQLite   = "sqlite"   // Local database file. Only one bot process can use it
+	DriverPostgres = "postgres" // Shared database server. Several bot replicas can use it
 
-	"github.com/jmoiron/sqlx"
-	_ "modernc.org/sqlite"
+	PausedIndefinitely int64 = math.MaxInt64 // Paused until date of channels paused until manual resume
 )
 
 var (
-	db     *sql.DB      // Variable to store the connection to the database of type sql.DB
-	sqlxdb *sqlx.DB     // Variable to store the connection to the database of type sqlx.DB (extended version of sql.DB)
-	dbLock sync.RWMutex // Mutex (blocker) to restrict simultaneous access to the database
+	store Store // Storage selected at Init. Used by package-level functions
+
+	ErrSchemaVersion = errors.New("database schema is not of the current version") // Returned by OpenExisting if database needs migration
 )
 
 type ChannelPropertiesEntity struct {
@@ -24,38 +29,182 @@ type ChannelPropertiesEntity struct {
 	Timeout              float64 `db:"timeout"`            // Time (hours) after which messages are deleted after sending
 	LastActivityDateUnix int64   `db:"last_activity_date"` // Date (unixtime) of the last activity in the channel
 	NextRemoveDateUnix   int64   `db:"next_remove_date"`   // Date (unixtime) of the next channel check for outdated messages
+	GuildID              string  `db:"guild_id"`           // Guild (server) ID of the channel. Empty if not resolved yet
+	PausedUntilDateUnix  int64   `db:"paused_until_date"`  // Date (unixtime) until which deletion is paused. 0 - not paused
+	IsPrecise            bool    `db:"is_precise"`         // Every message is deleted exactly when it becomes outdated
+	DeadlineDateUnix     int64   `db:"deadline_date"`      // Date (unixtime) when the oldest message waiting for deletion becomes too old for bulk delete. 0 - unknown
+	IsArchiveThreads     bool    `db:"is_archive_threads"` // Threads with activity are archived instead of deleted with their start messages
+	Version              int64   `db:"version"`            // Increased on every change of the channel except new messages. Set by storage
 }
 
-// Initializes the database globally (project).
-// Create a new storage or uses an existing one if it exists
-func Init(dbDirPath string) {
-	openTableConnection(dbDirPath + "/channels.db")
-	createChannelsTableIfNotExists()
+// Check if deletion in channel is paused at the moment
+func (channelProperties *ChannelPropertiesEntity) IsPaused(momentUnixTime int64) bool {
+	return channelProperties.PausedUntilDateUnix > momentUnixTime
+}
+
+// Gateway shards whose channels are selected. Channel belongs to shard of its guild, as Discord calculates it,
+// channel with unknown guild belongs to shard 0
+type ShardFilter struct {
+	Count int   // Total number of shards
+	IDs   []int // Selected shards
+}
+
+// Channels properties storage
+type Store interface {
+	// Delete channel properies
+	DeleteChannelProperties(channelID string) (err error)
+	// Delete channels properties
+	DeleteChannelsProperties(channelIDs []string) (err error)
+	// Get all channels properties
+	GetAllChannelsProperties() (channelsProperties []*ChannelPropertiesEntity, err error)
+	// Get channel properties. Returns nil if channel has no properties
+	GetChannelProperties(channelID string) (channelProperties *ChannelPropertiesEntity, err error)
+	// Save channel properties
+	WriteChannelProperties(channelProperties *ChannelPropertiesEntity) (err error)
+	// Save channels properties
+	WriteChannelsProperties(channelsProperties []*ChannelPropertiesEntity) (err error)
+	// Update last activity date (unix time) for channel
+	UpdateChannelLastActivityDate(channelID string, lastActivityUnixTime int64) (err error)
+	// Update next remove date (unix time) for channel
+	UpdateChannelNextRemoveDate(channelID string, nextRemoveDateUnixTime int64) (err error)
+	// Save new message in channel: update last activity and make the channel to be checked not later than the message removing date (unix time)
+	ScheduleChannelMessage(channelID string, messageDateUnixTime int64, removeDateUnixTime int64) (err error)
+	// Save state of channel after purge pass in one transaction, if the channel wasn't changed since the pass read it
+	CompletePurgePass(result *PurgePassResult) (isApplied bool, err error)
+	// Pause deletion in channel until specified date (unix time)
+	PauseChannel(channelID string, pausedUntilUnixTime int64) (err error)
+	// Resume deletion in channel. Channel is checked immediately and counts as active at resume date
+	ResumeChannel(channelID string, resumeDateUnixTime int64) (err error)
+	// Get not paused channels of the shards with remove date before specified date (unix time), from the nearest deadline.
+	// nil shards - channels of all shards
+	GetChannelsWithRemoveDateBeforeMoment(momentUnixTime int64, shards *ShardFilter) (channels []*ChannelPropertiesEntity, err error)
+	// Get IDs of not paused channels with remove date before specified date (unix time)
+	GetChannelsIdsWithRemoveDateBeforeMoment(momentUnixTime int64) (channelIDs []string, err error)
+	// Get properties of all channels in the guild
+	GetGuildChannelsProperties(guildID string) (channelsProperties []*ChannelPropertiesEntity, err error)
+	// Get page of guild channels properties ordered by channel ID
+	GetGuildChannelsPropertiesPage(guildID string, offset int, limit int) (channelsProperties []*ChannelPropertiesEntity, err error)
+	// Get number of channels with properties in the guild
+	CountGuildChannelsProperties(guildID string) (count int, err error)
+	// Delete properties of all channels and settings of the guild
+	DeleteGuildChannelsProperties(guildID string) (err error)
+	// Get IDs of channels with unknown guild
+	GetChannelsIdsWithoutGuild() (channelIDs []string, err error)
+	// Set guild ID for channel
+	UpdateChannelGuild(channelID string, guildID string) (err error)
+	// Save user timeout in channel
+	WriteUserTimeout(userTimeout *UserTimeoutEntity) (err error)
+	// Delete user timeout in channel
+	DeleteUserTimeout(channelID string, userID string) (err error)
+	// Get user timeout in channel. Returns nil if user has no own timeout
+	GetUserTimeout(channelID string, userID string) (userTimeout *UserTimeoutEntity, err error)
+	// Get timeouts of all users in channel
+	GetChannelUserTimeouts(channelID string) (userTimeouts []*UserTimeoutEntity, err error)
+	// Get timeouts of all users in all channels of the guild, ordered by channel
+	GetGuildUserTimeouts(guildID string) (userTimeouts []*UserTimeoutEntity, err error)
+	// Get timeouts of all users in the channels, ordered by channel
+	GetChannelsUserTimeouts(channelIDs []string) (userTimeouts []*UserTimeoutEntity, err error)
+	// Save expiring messages. Expire date of already saved messages is replaced
+	WriteExpiringMessages(expiringMessages []*ExpiringMessageEntity) (err error)
+	// Get messages of channel expired before specified date (unix time), from the earliest
+	GetChannelExpiringMessagesBeforeMoment(channelID string, momentUnixTime int64, limit int) (expiringMessages []*ExpiringMessageEntity, err error)
+	// Get the earliest expire date of every channel with expiring messages
+	GetChannelsNextExpireDates() (expireDates []*ChannelExpireDateEntity, err error)
+	// Get the earliest expire date (unix time) of messages in channel. isFound is false if channel has no expiring messages
+	GetChannelNextExpireDate(channelID string) (expireDateUnix int64, isFound bool, err error)
+	// Delete expiring messages of channel
+	DeleteExpiringMessages(channelID string, messageIDs []string) (err error)
+	// Delete all expiring messages of channel
+	DeleteChannelExpiringMessages(channelID string) (err error)
+	// Save new pending thread cleanups. Already saved threads are not changed
+	EnqueueThreadCleanups(threadCleanups []*ThreadCleanupEntity) (err error)
+	// Get all pending thread cleanups
+	GetPendingThreadCleanups() (threadCleanups []*ThreadCleanupEntity, err error)
+	// Get thread cleanup. Returns nil if thread is not queued
+	GetThreadCleanup(threadID string) (threadCleanup *ThreadCleanupEntity, err error)
+	// Get thread cleanups of channel, from the latest changed
+	GetChannelThreadCleanups(channelID string) (threadCleanups []*ThreadCleanupEntity, err error)
+	// Save status, attempts, error and next attempt date of thread cleanup
+	UpdateThreadCleanup(threadCleanup *ThreadCleanupEntity) (err error)
+	// Delete finished thread cleanups changed before specified date (unix time)
+	DeleteFinishedThreadCleanups(beforeUnixTime int64) (deletedNumber int64, err error)
+	// Get locale of bot replies in the guild. Empty if not set
+	GetGuildLocale(guildID string) (locale string, err error)
+	// Set locale of bot replies in the guild. Empty locale resets it
+	SetGuildLocale(guildID string, locale string) (err error)
+	// Make all channels to be checked for outdated messages immediately
+	RescheduleAllChannels() (channelsNumber int64, err error)
+	// Export configuration of all channels and guilds, or only of the guild if guildID is not empty
+	Export(guildID string) (document *ExportDocument, err error)
+	// Import configuration in one transaction. Mode is ImportMerge or ImportReplace
+	Import(document *ExportDocument, mode string) (err error)
+	// Save date (unix time) when the process was alive
+	WriteHeartbeat(processID string, dateUnixTime int64) (err error)
+	// Get date (unix time) when the process was alive last time. isFound is false if the process has never run
+	GetHeartbeat(processID string) (dateUnixTime int64, isFound bool, err error)
+	// Save audit entry
+	WriteAuditEntry(auditEntry *AuditEntryEntity) (err error)
+	// Get audit entries matching filter, from the newest
+	GetAuditEntries(filter AuditFilter) (auditEntries []*AuditEntryEntity, err error)
+	// Close connection to the storage
+	Close() (err error)
+}
 
-	sqlxdb = sqlx.NewDb(db, "sqlite3")
+// Storage in a local database file that can be maintained by the bot itself
+type FileStore interface {
+	// Write consistent copy of the database to the file
+	Backup(backupPath string) (err error)
+	// Rebuild the database file to reclaim unused space
+	Vacuum() (err error)
 }
 
-// Open global (project) connection to DB.
-// Open exists db file or create new
-func openTableConnection(dbPath string) {
+// Initializes the storage globally (project).
+// dataSource is a database file path for SQLite or a connection string for PostgreSQL.
+// Create a new storage or uses an existing one if it exists
+func Init(driver string, dataSource string) {
 	var err error
-	db, err = sql.Open("sqlite", dbPath)
+	store, err = Open(driver, dataSource)
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		log.Fatalf("Failed to open storage: %v", err)
 	}
 }
 
-// Create table if it doesn't exists
-func createChannelsTableIfNotExists() {
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS channels (
-			channel_id TEXT PRIMARY KEY,
-			timeout REAL,
-			last_activity_date INTEGER,
-			next_remove_date INTEGER
-		)
-	`)
+// Open storage of specified driver and migrate it to the current schema
+func Open(driver string, dataSource string) (Store, error) {
+	switch driver {
+	case DriverSQLite:
+		return NewSQLiteStore(dataSource)
+	case DriverPostgres:
+		return NewPostgresStore(dataSource)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
+
+// Initializes the storage globally without changing the database, e.g. to read it by admin subcommands.
+// Fails if the database schema is not of the current version
+func InitExisting(driver string, dataSource string) (err error) {
+	existingStore, err := OpenExisting(driver, dataSource)
 	if err != nil {
-		log.Fatalf("Failed to create table: %v", err)
+		return err
 	}
+	store = existingStore
+	return nil
+}
+
+// Open storage of specified driver without migrating it
+func OpenExisting(driver string, dataSource string) (Store, error) {
+	switch driver {
+	case DriverSQLite:
+		return NewExistingSQLiteStore(dataSource)
+	case DriverPostgres:
+		return NewExistingPostgresStore(dataSource)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
+
+// Close global storage
+func Close() (err error) {
+	return store.Close()
 }
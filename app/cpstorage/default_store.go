@@ -0,0 +1,261 @@
+package cpstorage
+
+// Package-level operations over the storage selected at Init
+
+import (
+	"fmt"
+)
+
+// Delete channel properies
+func DeleteChannelProperties(channelID string) (err error) {
+	return store.DeleteChannelProperties(channelID)
+}
+
+// Delete channels properties
+func DeleteChannelsProperties(channelIDs []string) (err error) {
+	return store.DeleteChannelsProperties(channelIDs)
+}
+
+// Get all channels properties
+func GetAllChannelsProperties() (channelsProperties []*ChannelPropertiesEntity, err error) {
+	return store.GetAllChannelsProperties()
+}
+
+// Get channel properties. Returns nil if channel has no properties
+func GetChannelProperties(channelID string) (channelProperties *ChannelPropertiesEntity, err error) {
+	return store.GetChannelProperties(channelID)
+}
+
+// Save channel properties
+func WriteChannelProperties(channelProperties *ChannelPropertiesEntity) (err error) {
+	return store.WriteChannelProperties(channelProperties)
+}
+
+// Save channels properties
+func WriteChannelsProperties(channelsProperties []*ChannelPropertiesEntity) (err error) {
+	return store.WriteChannelsProperties(channelsProperties)
+}
+
+// Update last activity date (unix time) for channel
+func UpdateChannelLastActivityDate(channelID string, lastActivityUnixTime int64) (err error) {
+	return store.UpdateChannelLastActivityDate(channelID, lastActivityUnixTime)
+}
+
+// Update next remove date (unix time) for channel
+func UpdateChannelNextRemoveDate(channelID string, nextRemoveDateUnixTime int64) (err error) {
+	return store.UpdateChannelNextRemoveDate(channelID, nextRemoveDateUnixTime)
+}
+
+// Save new message in channel: update last activity and make the channel to be checked not later than the message removing date (unix time)
+func ScheduleChannelMessage(channelID string, messageDateUnixTime int64, removeDateUnixTime int64) (err error) {
+	return store.ScheduleChannelMessage(channelID, messageDateUnixTime, removeDateUnixTime)
+}
+
+// Save state of channel after purge pass in one transaction, if the channel wasn't changed since the pass read it
+func CompletePurgePass(result *PurgePassResult) (isApplied bool, err error) {
+	return store.CompletePurgePass(result)
+}
+
+// Pause deletion in channel until specified date (unix time)
+func PauseChannel(channelID string, pausedUntilUnixTime int64) (err error) {
+	return store.PauseChannel(channelID, pausedUntilUnixTime)
+}
+
+// Resume deletion in channel. Channel is checked immediately and counts as active at resume date
+func ResumeChannel(channelID string, resumeDateUnixTime int64) (err error) {
+	return store.ResumeChannel(channelID, resumeDateUnixTime)
+}
+
+// Get not paused channels of the shards with remove date before specified date (unix time), from the nearest deadline.
+// nil shards - channels of all shards
+func GetChannelsWithRemoveDateBeforeMoment(momentUnixTime int64, shards *ShardFilter) (channels []*ChannelPropertiesEntity, err error) {
+	return store.GetChannelsWithRemoveDateBeforeMoment(momentUnixTime, shards)
+}
+
+// Get IDs of not paused channels with remove date before specified date (unix time)
+func GetChannelsIdsWithRemoveDateBeforeMoment(momentUnixTime int64) (channelIDs []string, err error) {
+	return store.GetChannelsIdsWithRemoveDateBeforeMoment(momentUnixTime)
+}
+
+// Get properties of all channels in the guild
+func GetGuildChannelsProperties(guildID string) (channelsProperties []*ChannelPropertiesEntity, err error) {
+	return store.GetGuildChannelsProperties(guildID)
+}
+
+// Get page of guild channels properties ordered by channel ID
+func GetGuildChannelsPropertiesPage(guildID string, offset int, limit int) (channelsProperties []*ChannelPropertiesEntity, err error) {
+	return store.GetGuildChannelsPropertiesPage(guildID, offset, limit)
+}
+
+// Get number of channels with properties in the guild
+func CountGuildChannelsProperties(guildID string) (count int, err error) {
+	return store.CountGuildChannelsProperties(guildID)
+}
+
+// Delete properties of all channels and settings of the guild
+func DeleteGuildChannelsProperties(guildID string) (err error) {
+	return store.DeleteGuildChannelsProperties(guildID)
+}
+
+// Get IDs of channels with unknown guild
+func GetChannelsIdsWithoutGuild() (channelIDs []string, err error) {
+	return store.GetChannelsIdsWithoutGuild()
+}
+
+// Set guild ID for channel
+func UpdateChannelGuild(channelID string, guildID string) (err error) {
+	return store.UpdateChannelGuild(channelID, guildID)
+}
+
+// Save user timeout in channel
+func WriteUserTimeout(userTimeout *UserTimeoutEntity) (err error) {
+	return store.WriteUserTimeout(userTimeout)
+}
+
+// Delete user timeout in channel
+func DeleteUserTimeout(channelID string, userID string) (err error) {
+	return store.DeleteUserTimeout(channelID, userID)
+}
+
+// Get user timeout in channel. Returns nil if user has no own timeout
+func GetUserTimeout(channelID string, userID string) (userTimeout *UserTimeoutEntity, err error) {
+	return store.GetUserTimeout(channelID, userID)
+}
+
+// Get timeouts of all users in channel
+func GetChannelUserTimeouts(channelID string) (userTimeouts []*UserTimeoutEntity, err error) {
+	return store.GetChannelUserTimeouts(channelID)
+}
+
+// Get timeouts of all users in all channels of the guild, ordered by channel
+func GetGuildUserTimeouts(guildID string) (userTimeouts []*UserTimeoutEntity, err error) {
+	return store.GetGuildUserTimeouts(guildID)
+}
+
+// Get timeouts of all users in the channels, ordered by channel
+func GetChannelsUserTimeouts(channelIDs []string) (userTimeouts []*UserTimeoutEntity, err error) {
+	return store.GetChannelsUserTimeouts(channelIDs)
+}
+
+// Save expiring messages. Expire date of already saved messages is replaced
+func WriteExpiringMessages(expiringMessages []*ExpiringMessageEntity) (err error) {
+	return store.WriteExpiringMessages(expiringMessages)
+}
+
+// Get messages of channel expired before specified date (unix time), from the earliest
+func GetChannelExpiringMessagesBeforeMoment(channelID string, momentUnixTime int64, limit int) (expiringMessages []*ExpiringMessageEntity, err error) {
+	return store.GetChannelExpiringMessagesBeforeMoment(channelID, momentUnixTime, limit)
+}
+
+// Get the earliest expire date of every channel with expiring messages
+func GetChannelsNextExpireDates() (expireDates []*ChannelExpireDateEntity, err error) {
+	return store.GetChannelsNextExpireDates()
+}
+
+// Get the earliest expire date (unix time) of messages in channel. isFound is false if channel has no expiring messages
+func GetChannelNextExpireDate(channelID string) (expireDateUnix int64, isFound bool, err error) {
+	return store.GetChannelNextExpireDate(channelID)
+}
+
+// Delete expiring messages of channel
+func DeleteExpiringMessages(channelID string, messageIDs []string) (err error) {
+	return store.DeleteExpiringMessages(channelID, messageIDs)
+}
+
+// Delete all expiring messages of channel
+func DeleteChannelExpiringMessages(channelID string) (err error) {
+	return store.DeleteChannelExpiringMessages(channelID)
+}
+
+// Save new pending thread cleanups. Already saved threads are not changed
+func EnqueueThreadCleanups(threadCleanups []*ThreadCleanupEntity) (err error) {
+	return store.EnqueueThreadCleanups(threadCleanups)
+}
+
+// Get all pending thread cleanups
+func GetPendingThreadCleanups() (threadCleanups []*ThreadCleanupEntity, err error) {
+	return store.GetPendingThreadCleanups()
+}
+
+// Get thread cleanup. Returns nil if thread is not queued
+func GetThreadCleanup(threadID string) (threadCleanup *ThreadCleanupEntity, err error) {
+	return store.GetThreadCleanup(threadID)
+}
+
+// Get thread cleanups of channel, from the latest changed
+func GetChannelThreadCleanups(channelID string) (threadCleanups []*ThreadCleanupEntity, err error) {
+	return store.GetChannelThreadCleanups(channelID)
+}
+
+// Save status, attempts, error and next attempt date of thread cleanup
+func UpdateThreadCleanup(threadCleanup *ThreadCleanupEntity) (err error) {
+	return store.UpdateThreadCleanup(threadCleanup)
+}
+
+// Delete finished thread cleanups changed before specified date (unix time)
+func DeleteFinishedThreadCleanups(beforeUnixTime int64) (deletedNumber int64, err error) {
+	return store.DeleteFinishedThreadCleanups(beforeUnixTime)
+}
+
+// Get locale of bot replies in the guild. Empty if not set
+func GetGuildLocale(guildID string) (locale string, err error) {
+	return store.GetGuildLocale(guildID)
+}
+
+// Set locale of bot replies in the guild. Empty locale resets it
+func SetGuildLocale(guildID string, locale string) (err error) {
+	return store.SetGuildLocale(guildID, locale)
+}
+
+// Save date (unix time) when the process was alive
+func WriteHeartbeat(processID string, dateUnixTime int64) (err error) {
+	return store.WriteHeartbeat(processID, dateUnixTime)
+}
+
+// Get date (unix time) when the process was alive last time. isFound is false if the process has never run
+func GetHeartbeat(processID string) (dateUnixTime int64, isFound bool, err error) {
+	return store.GetHeartbeat(processID)
+}
+
+// Save audit entry
+func WriteAuditEntry(auditEntry *AuditEntryEntity) (err error) {
+	return store.WriteAuditEntry(auditEntry)
+}
+
+// Get audit entries matching filter, from the newest
+func GetAuditEntries(filter AuditFilter) (auditEntries []*AuditEntryEntity, err error) {
+	return store.GetAuditEntries(filter)
+}
+
+// Make all channels to be checked for outdated messages immediately
+func RescheduleAllChannels() (channelsNumber int64, err error) {
+	return store.RescheduleAllChannels()
+}
+
+// Export configuration of all channels and guilds, or only of the guild if guildID is not empty
+func Export(guildID string) (document *ExportDocument, err error) {
+	return store.Export(guildID)
+}
+
+// Import configuration in one transaction. Mode is ImportMerge or ImportReplace
+func Import(document *ExportDocument, mode string) (err error) {
+	return store.Import(document, mode)
+}
+
+// Write consistent copy of the database to the file. Only for file storages
+func Backup(backupPath string) (err error) {
+	fileStore, ok := store.(FileStore)
+	if !ok {
+		return fmt.Errorf("backup is supported only by file storage")
+	}
+	return fileStore.Backup(backupPath)
+}
+
+// Rebuild the database file to reclaim unused space. Only for file storages
+func Vacuum() (err error) {
+	fileStore, ok := store.(FileStore)
+	if !ok {
+		return fmt.Errorf("vacuum is supported only by file storage")
+	}
+	return fileStore.Vacuum()
+}
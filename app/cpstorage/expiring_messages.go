@@ -0,0 +1,111 @@
+package cpstorage
+
+// Messages of channels in precise mode waiting for deletion
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ExpiringMessageEntity struct {
+	ChannelID      string `db:"channel_id"`  // Channel of the message
+	MessageID      string `db:"message_id"`  // Message ID
+	AuthorID       string `db:"author_id"`   // Author of the message. Lifetime may depend on it
+	ExpireDateUnix int64  `db:"expire_date"` // Date (unixtime) when the message becomes outdated
+}
+
+// Save expiring messages. Expire date of already saved messages is replaced
+func (s *sqlStore) WriteExpiringMessages(expiringMessages []*ExpiringMessageEntity) (err error) {
+	if len(expiringMessages) == 0 {
+		return nil
+	}
+
+	return s.inTransaction(func(transaction *sqlx.Tx) error {
+		query := `
+			INSERT INTO expiring_messages
+				(channel_id, message_id, author_id, expire_date)
+				VALUES (?, ?, ?, ?)
+			ON CONFLICT (channel_id, message_id) DO UPDATE SET
+				expire_date = excluded.expire_date
+		`
+		statement, err := transaction.Preparex(transaction.Rebind(query))
+		if err != nil {
+			return err
+		}
+		defer statement.Close()
+
+		for _, expiringMessage := range expiringMessages {
+			_, err = statement.Exec(expiringMessage.ChannelID, expiringMessage.MessageID, expiringMessage.AuthorID, expiringMessage.ExpireDateUnix)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Earliest expire date of messages in channel
+type ChannelExpireDateEntity struct {
+	ChannelID      string `db:"channel_id"`  // Channel ID
+	GuildID        string `db:"guild_id"`    // Guild of the channel. Empty if unknown or channel has no properties
+	ExpireDateUnix int64  `db:"expire_date"` // The earliest expire date (unixtime) of messages in channel
+}
+
+// Get messages of channel expired before specified date (unix time), from the earliest
+func (s *sqlStore) GetChannelExpiringMessagesBeforeMoment(channelID string, momentUnixTime int64, limit int) (expiringMessages []*ExpiringMessageEntity, err error) {
+	query := `
+		SELECT * FROM expiring_messages
+		WHERE channel_id = ? AND expire_date <= ?
+		ORDER BY expire_date
+		LIMIT ?
+	`
+	err = s.db.Select(&expiringMessages, s.db.Rebind(query), channelID, momentUnixTime, limit)
+	return
+}
+
+// Get the earliest expire date of every channel with expiring messages
+func (s *sqlStore) GetChannelsNextExpireDates() (expireDates []*ChannelExpireDateEntity, err error) {
+	query := `
+		SELECT
+			expiring_messages.channel_id,
+			COALESCE(channels.guild_id, '') AS guild_id,
+			MIN(expiring_messages.expire_date) AS expire_date
+		FROM expiring_messages
+		LEFT JOIN channels ON channels.channel_id = expiring_messages.channel_id
+		GROUP BY expiring_messages.channel_id, channels.guild_id
+	`
+	err = s.db.Select(&expireDates, query)
+	return
+}
+
+// Get the earliest expire date (unix time) of messages in channel. isFound is false if channel has no expiring messages
+func (s *sqlStore) GetChannelNextExpireDate(channelID string) (expireDateUnix int64, isFound bool, err error) {
+	var expireDate sql.NullInt64
+	err = s.db.Get(&expireDate, s.db.Rebind("SELECT MIN(expire_date) FROM expiring_messages WHERE channel_id = ?"), channelID)
+	if err != nil {
+		return 0, false, err
+	}
+	return expireDate.Int64, expireDate.Valid, nil
+}
+
+// Delete expiring messages of channel
+func (s *sqlStore) DeleteExpiringMessages(channelID string, messageIDs []string) (err error) {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	query, args, err := sqlx.In("DELETE FROM expiring_messages WHERE channel_id = ? AND message_id IN (?)", channelID, messageIDs)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(s.db.Rebind(query), args...)
+	return
+}
+
+// Delete all expiring messages of channel
+func (s *sqlStore) DeleteChannelExpiringMessages(channelID string) (err error) {
+	_, err = s.db.Exec(s.db.Rebind("DELETE FROM expiring_messages WHERE channel_id = ?"), channelID)
+	return
+}
@@ -0,0 +1,249 @@
+package cpstorage
+
+// Export and import of all configuration tables as a versioned JSON document
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const ExportVersion = 1 // Version of export document format. Increased on incompatible changes
+
+const (
+	ImportMerge   = "merge"   // Imported records replace existing ones with the same keys, other records are kept
+	ImportReplace = "replace" // All existing configuration is deleted before import
+)
+
+// Configuration of channels and guilds. Runtime state (next remove dates) is not exported
+type ExportDocument struct {
+	Version       int                  `json:"version"`
+	ExportedAt    int64                `json:"exported_at"` // Date (unixtime) of export
+	Channels      []*ExportChannel     `json:"channels"`
+	UserTimeouts  []*ExportUserTimeout `json:"user_timeouts"`
+	GuildSettings []*ExportGuild       `json:"guild_settings"`
+}
+
+type ExportChannel struct {
+	ChannelID            string  `json:"channel_id"`
+	GuildID              string  `json:"guild_id"`
+	Timeout              float64 `json:"timeout_hours"`
+	LastActivityDateUnix int64   `json:"last_activity_date"`
+	PausedUntilDateUnix  int64   `json:"paused_until_date"`
+	IsPrecise            bool    `json:"precise,omitempty"`
+	IsArchiveThreads     bool    `json:"archive_threads,omitempty"`
+}
+
+type ExportUserTimeout struct {
+	ChannelID string  `json:"channel_id"`
+	UserID    string  `json:"user_id"`
+	Timeout   float64 `json:"timeout_hours"`
+	IsOwn     bool    `json:"own,omitempty"`
+}
+
+type ExportGuild struct {
+	GuildID string `db:"guild_id" json:"guild_id"`
+	Locale  string `db:"locale" json:"locale"`
+}
+
+// Read export document and check it
+func DecodeExportDocument(reader io.Reader) (document *ExportDocument, err error) {
+	document = &ExportDocument{}
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(document)
+	if err != nil {
+		return nil, fmt.Errorf("invalid export document: %w", err)
+	}
+
+	err = document.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// Check that document can be imported. All problems are reported together
+func (document *ExportDocument) Validate() error {
+	var errs []error
+
+	if document.Version < 1 || document.Version > ExportVersion {
+		// Records can't be checked in unknown format
+		return fmt.Errorf("unsupported export version %d, supported up to %d", document.Version, ExportVersion)
+	}
+
+	channelIDs := map[string]bool{}
+	for i, channel := range document.Channels {
+		if channel.ChannelID == "" {
+			errs = append(errs, fmt.Errorf("channels[%d]: channel_id is empty", i))
+		} else if channelIDs[channel.ChannelID] {
+			errs = append(errs, fmt.Errorf("channels[%d]: duplicate channel %s", i, channel.ChannelID))
+		}
+		channelIDs[channel.ChannelID] = true
+
+		if channel.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("channels[%d]: timeout_hours must be positive, got %v", i, channel.Timeout))
+		}
+		if channel.PausedUntilDateUnix < 0 {
+			errs = append(errs, fmt.Errorf("channels[%d]: paused_until_date must not be negative", i))
+		}
+	}
+
+	userTimeoutKeys := map[[2]string]bool{}
+	for i, userTimeout := range document.UserTimeouts {
+		key := [2]string{userTimeout.ChannelID, userTimeout.UserID}
+		if !channelIDs[userTimeout.ChannelID] {
+			errs = append(errs, fmt.Errorf("user_timeouts[%d]: channel %s is not in channels", i, userTimeout.ChannelID))
+		}
+		if userTimeout.UserID == "" {
+			errs = append(errs, fmt.Errorf("user_timeouts[%d]: user_id is empty", i))
+		} else if userTimeoutKeys[key] {
+			errs = append(errs, fmt.Errorf("user_timeouts[%d]: duplicate user %s in channel %s", i, userTimeout.UserID, userTimeout.ChannelID))
+		}
+		userTimeoutKeys[key] = true
+
+		if userTimeout.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("user_timeouts[%d]: timeout_hours must be positive, got %v", i, userTimeout.Timeout))
+		}
+	}
+
+	guildIDs := map[string]bool{}
+	for i, guild := range document.GuildSettings {
+		if guild.GuildID == "" {
+			errs = append(errs, fmt.Errorf("guild_settings[%d]: guild_id is empty", i))
+		} else if guildIDs[guild.GuildID] {
+			errs = append(errs, fmt.Errorf("guild_settings[%d]: duplicate guild %s", i, guild.GuildID))
+		}
+		guildIDs[guild.GuildID] = true
+	}
+
+	return errors.Join(errs...)
+}
+
+// Export configuration of all channels and guilds, or only of the guild if guildID is not empty
+func (s *sqlStore) Export(guildID string) (document *ExportDocument, err error) {
+	document = &ExportDocument{
+		Version:       ExportVersion,
+		ExportedAt:    time.Now().Unix(),
+		Channels:      []*ExportChannel{},
+		UserTimeouts:  []*ExportUserTimeout{},
+		GuildSettings: []*ExportGuild{},
+	}
+
+	var channelsProperties []*ChannelPropertiesEntity
+	var userTimeouts []*UserTimeoutEntity
+	if guildID == "" {
+		err = s.db.Select(&channelsProperties, "SELECT * FROM channels ORDER BY channel_id")
+		if err == nil {
+			err = s.db.Select(&userTimeouts, "SELECT * FROM user_timeouts ORDER BY channel_id, user_id")
+		}
+		if err == nil {
+			err = s.db.Select(&document.GuildSettings, "SELECT guild_id, locale FROM guild_settings ORDER BY guild_id")
+		}
+	} else {
+		err = s.db.Select(&channelsProperties, s.db.Rebind("SELECT * FROM channels WHERE guild_id = ? ORDER BY channel_id"), guildID)
+		if err == nil {
+			userTimeouts, err = s.GetGuildUserTimeouts(guildID)
+		}
+		if err == nil {
+			err = s.db.Select(&document.GuildSettings, s.db.Rebind("SELECT guild_id, locale FROM guild_settings WHERE guild_id = ?"), guildID)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, channelProperties := range channelsProperties {
+		document.Channels = append(document.Channels, &ExportChannel{
+			ChannelID:            channelProperties.ChannelID,
+			GuildID:              channelProperties.GuildID,
+			Timeout:              channelProperties.Timeout,
+			LastActivityDateUnix: channelProperties.LastActivityDateUnix,
+			PausedUntilDateUnix:  channelProperties.PausedUntilDateUnix,
+			IsPrecise:            channelProperties.IsPrecise,
+			IsArchiveThreads:     channelProperties.IsArchiveThreads,
+		})
+	}
+	for _, userTimeout := range userTimeouts {
+		document.UserTimeouts = append(document.UserTimeouts, &ExportUserTimeout{
+			ChannelID: userTimeout.ChannelID,
+			UserID:    userTimeout.UserID,
+			Timeout:   userTimeout.Timeout,
+			IsOwn:     userTimeout.IsOwn,
+		})
+	}
+
+	return document, nil
+}
+
+// Import configuration in one transaction. Imported channels are checked for outdated messages immediately
+func (s *sqlStore) Import(document *ExportDocument, mode string) (err error) {
+	if mode != ImportMerge && mode != ImportReplace {
+		return fmt.Errorf("unknown import mode %q", mode)
+	}
+	err = document.Validate()
+	if err != nil {
+		return err
+	}
+
+	return s.inTransaction(func(transaction *sqlx.Tx) error {
+		if mode == ImportReplace {
+			for _, table := range []string{"user_timeouts", "expiring_messages", "thread_cleanups", "channels", "guild_settings"} {
+				_, err := transaction.Exec("DELETE FROM " + table)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, channel := range document.Channels {
+			// Merged channel gets user timeouts only from the document
+			_, err := transaction.Exec(transaction.Rebind("DELETE FROM user_timeouts WHERE channel_id = ?"), channel.ChannelID)
+			if err != nil {
+				return err
+			}
+
+			_, err = transaction.Exec(transaction.Rebind(upsertChannelPropertiesQuery),
+				channel.ChannelID,
+				channel.Timeout,
+				channel.LastActivityDateUnix,
+				0, // Channel must be checked now
+				channel.GuildID,
+				channel.PausedUntilDateUnix,
+				channel.IsPrecise,
+				channel.IsArchiveThreads)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, userTimeout := range document.UserTimeouts {
+			_, err := transaction.Exec(transaction.Rebind("INSERT INTO user_timeouts (channel_id, user_id, timeout, is_own) VALUES (?, ?, ?, ?)"),
+				userTimeout.ChannelID, userTimeout.UserID, userTimeout.Timeout, userTimeout.IsOwn)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, guild := range document.GuildSettings {
+			query := `
+				INSERT INTO guild_settings
+					(guild_id, locale)
+					VALUES (?, ?)
+				ON CONFLICT (guild_id) DO UPDATE SET
+					locale = excluded.locale
+			`
+			_, err := transaction.Exec(transaction.Rebind(query), guild.GuildID, guild.Locale)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
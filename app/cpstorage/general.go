@@ -4,82 +4,98 @@ package cpstorage
 
 import (
 	"database/sql"
-	"fmt"
+
+	"github.com/jmoiron/sqlx"
 )
 
-// Delete channel properies
-func DeleteChannelProperties(channelID string) (err error) {
-	dbLock.Lock()
-	defer dbLock.Unlock()
+// Save result of purge pass if channel is not changed since it was read
+const completePurgePassQuery = `
+	UPDATE channels
+	SET
+		last_activity_date = CASE WHEN last_activity_date > ? THEN last_activity_date ELSE ? END,
+		next_remove_date = ?,
+		deadline_date = ?,
+		version = version + 1
+	WHERE channel_id = ? AND version = ?
+`
+
+// Delete inactive channel if it is not changed since it was read. New message makes the channel active again
+const deleteInactiveChannelQuery = "DELETE FROM channels WHERE channel_id = ? AND version = ? AND last_activity_date <= ?"
+
+// Insert or replace all channel properties. Works both in SQLite and PostgreSQL
+const upsertChannelPropertiesQuery = `
+	INSERT INTO channels
+		(channel_id, timeout, last_activity_date, next_remove_date, guild_id, paused_until_date, is_precise, is_archive_threads)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (channel_id) DO UPDATE SET
+		timeout = excluded.timeout,
+		last_activity_date = excluded.last_activity_date,
+		next_remove_date = excluded.next_remove_date,
+		guild_id = excluded.guild_id,
+		paused_until_date = excluded.paused_until_date,
+		is_precise = excluded.is_precise,
+		is_archive_threads = excluded.is_archive_threads,
+		version = channels.version + 1
+`
 
-	_, err = db.Exec("DELETE FROM channels WHERE channel_id = ?", channelID)
-	return
+// Delete channel properies
+func (s *sqlStore) DeleteChannelProperties(channelID string) (err error) {
+	return s.inTransaction(func(transaction *sqlx.Tx) error {
+		return deleteChannelInTransaction(transaction, channelID)
+	})
 }
 
 // Delete channels properties
-func DeleteChannelsProperties(channelIDs []string) (err error) {
+func (s *sqlStore) DeleteChannelsProperties(channelIDs []string) (err error) {
 	if len(channelIDs) == 0 {
 		return nil
 	}
 
-	dbLock.Lock()
-	defer dbLock.Unlock()
-
 	// Use transaction to delete all array as one action
-	transaction, err := db.Begin()
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err != nil {
-			rolbackErr := transaction.Rollback()
-			if rolbackErr != nil {
-				err = fmt.Errorf("failed to rollback transcation %v, after write error: %v", rolbackErr, err)
+	return s.inTransaction(func(transaction *sqlx.Tx) error {
+		for _, channelId := range channelIDs {
+			err := deleteChannelInTransaction(transaction, channelId)
+			if err != nil {
+				return err
 			}
-		} else {
-			err = transaction.Commit()
 		}
-	}()
 
-	// prepared delete statement
-	statement, err := transaction.Prepare(`
-		DELETE FROM channels 
-		WHERE channel_id = ?
-    `)
+		return nil
+	})
+}
+
+// Delete channel properties with everything that belongs to the channel
+func deleteChannelInTransaction(transaction *sqlx.Tx, channelID string) (err error) {
+	err = deleteChannelDataInTransaction(transaction, channelID)
 	if err != nil {
 		return err
 	}
-	defer statement.Close()
 
-	// insert each of channels ids in prepared statement
-	for _, channelId := range channelIDs {
-		_, err = statement.Exec(
-			channelId,
-		)
+	_, err = transaction.Exec(transaction.Rebind("DELETE FROM channels WHERE channel_id = ?"), channelID)
+	return err
+}
+
+// Delete user timeouts, expiring messages and thread cleanups of the channel
+func deleteChannelDataInTransaction(transaction *sqlx.Tx, channelID string) (err error) {
+	for _, table := range []string{"user_timeouts", "expiring_messages", "thread_cleanups"} {
+		_, err = transaction.Exec(transaction.Rebind("DELETE FROM "+table+" WHERE channel_id = ?"), channelID)
 		if err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
 // Get all channels properties
-func GetAllChannelsProperties() (channelsProperties []*ChannelPropertiesEntity, err error) {
-	dbLock.RLock()
-	defer dbLock.RUnlock()
-
-	err = sqlxdb.Select(&channelsProperties, "SELECT * FROM channels")
+func (s *sqlStore) GetAllChannelsProperties() (channelsProperties []*ChannelPropertiesEntity, err error) {
+	err = s.db.Select(&channelsProperties, "SELECT * FROM channels")
 	return
 }
 
 // Get channel properties
-func GetChannelProperties(channelID string) (channelProperties *ChannelPropertiesEntity, err error) {
-	dbLock.RLock()
-	defer dbLock.RUnlock()
-
+func (s *sqlStore) GetChannelProperties(channelID string) (channelProperties *ChannelPropertiesEntity, err error) {
 	channelProperties = &ChannelPropertiesEntity{}
-	err = sqlxdb.Get(channelProperties, "SELECT * FROM channels WHERE channel_id = $1", channelID)
+	err = s.db.Get(channelProperties, s.db.Rebind("SELECT * FROM channels WHERE channel_id = ?"), channelID)
 
 	if err == sql.ErrNoRows {
 		err = nil
@@ -90,84 +106,150 @@ func GetChannelProperties(channelID string) (channelProperties *ChannelPropertie
 }
 
 // Save channel properties
-func WriteChannelProperties(channelProperties *ChannelPropertiesEntity) (err error) {
-	dbLock.Lock()
-	defer dbLock.Unlock()
-
-	_, err = db.Exec(`
-		INSERT OR REPLACE INTO channels
-			(channel_id, timeout, last_activity_date, next_remove_date)
-			VALUES (?, ?, ?, ?)`,
+func (s *sqlStore) WriteChannelProperties(channelProperties *ChannelPropertiesEntity) (err error) {
+	_, err = s.db.Exec(s.db.Rebind(upsertChannelPropertiesQuery),
 		channelProperties.ChannelID,
 		channelProperties.Timeout,
 		channelProperties.LastActivityDateUnix,
-		channelProperties.NextRemoveDateUnix)
+		channelProperties.NextRemoveDateUnix,
+		channelProperties.GuildID,
+		channelProperties.PausedUntilDateUnix,
+		channelProperties.IsPrecise,
+		channelProperties.IsArchiveThreads)
 
 	return
 }
 
 // Save channels properties
-func WriteChannelsProperties(channelsProperties []*ChannelPropertiesEntity) (err error) {
-	dbLock.Lock()
-	defer dbLock.Unlock()
-
+func (s *sqlStore) WriteChannelsProperties(channelsProperties []*ChannelPropertiesEntity) (err error) {
 	// Use transaction to save all array as one action
-	transaction, err := db.Begin()
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err != nil {
-			rolbackErr := transaction.Rollback()
-			if rolbackErr != nil {
-				err = fmt.Errorf("failed to rollback transcation %v, after write error: %v", rolbackErr, err)
-			}
-		} else {
-			err = transaction.Commit()
-		}
-	}()
-
-	// prepared write statement
-	statement, err := transaction.Prepare(`
-        INSERT OR REPLACE INTO channels
-            (channel_id, timeout, last_activity_date, next_remove_date)
-        	VALUES (?, ?, ?, ?)
-    `)
-	if err != nil {
-		return err
-	}
-	defer statement.Close()
-
-	// insert each of channels properties in prepared statement
-	for _, channelProperties := range channelsProperties {
-		_, err = statement.Exec(
-			channelProperties.ChannelID,
-			channelProperties.Timeout,
-			channelProperties.LastActivityDateUnix,
-			channelProperties.NextRemoveDateUnix,
-		)
+	return s.inTransaction(func(transaction *sqlx.Tx) error {
+		// prepared write statement
+		statement, err := transaction.Preparex(transaction.Rebind(upsertChannelPropertiesQuery))
 		if err != nil {
 			return err
 		}
-	}
+		defer statement.Close()
+
+		// insert each of channels properties in prepared statement
+		for _, channelProperties := range channelsProperties {
+			_, err = statement.Exec(
+				channelProperties.ChannelID,
+				channelProperties.Timeout,
+				channelProperties.LastActivityDateUnix,
+				channelProperties.NextRemoveDateUnix,
+				channelProperties.GuildID,
+				channelProperties.PausedUntilDateUnix,
+				channelProperties.IsPrecise,
+				channelProperties.IsArchiveThreads,
+			)
+			if err != nil {
+				return err
+			}
+		}
 
-	return nil
+		return nil
+	})
 }
 
 // Update last activity date (unix time) for channel
-func UpdateChannelLastActivityDate(channelID string, lastActivityUnixTime int64) (err error) {
-	dbLock.Lock()
-	defer dbLock.Unlock()
+func (s *sqlStore) UpdateChannelLastActivityDate(channelID string, lastActivityUnixTime int64) (err error) {
+	_, err = s.db.Exec(s.db.Rebind("UPDATE channels SET last_activity_date = ?, version = version + 1 WHERE channel_id = ?"), lastActivityUnixTime, channelID)
+	return
+}
 
-	_, err = db.Exec("UPDATE channels SET last_activity_date = ? WHERE channel_id = ?", lastActivityUnixTime, channelID)
+// Update next remove date (unix time) for channel
+func (s *sqlStore) UpdateChannelNextRemoveDate(channelID string, nextRemoveDateUnixTime int64) (err error) {
+	_, err = s.db.Exec(s.db.Rebind("UPDATE channels SET next_remove_date = ?, version = version + 1 WHERE channel_id = ?"), nextRemoveDateUnixTime, channelID)
 	return
 }
 
-// Update last activity date (unix time) for channel
-func UpdateChannelNextRemoveDate(channelID string, nextRemoveDateUnixTime int64) (err error) {
-	dbLock.Lock()
-	defer dbLock.Unlock()
+// Save new message in channel: update last activity and make the channel to be checked
+// not later than the message removing date (unix time).
+// Version is not changed, dates are merged with the result of a purge pass running at the same time
+func (s *sqlStore) ScheduleChannelMessage(channelID string, messageDateUnixTime int64, removeDateUnixTime int64) (err error) {
+	query := `
+		UPDATE channels
+		SET
+			last_activity_date = CASE WHEN last_activity_date > ? THEN last_activity_date ELSE ? END,
+			next_remove_date = CASE WHEN next_remove_date > ? THEN ? ELSE next_remove_date END
+		WHERE channel_id = ?
+	`
+	_, err = s.db.Exec(s.db.Rebind(query), messageDateUnixTime, messageDateUnixTime, removeDateUnixTime, removeDateUnixTime, channelID)
+	return
+}
+
+// Pause deletion in channel until specified date (unix time)
+func (s *sqlStore) PauseChannel(channelID string, pausedUntilUnixTime int64) (err error) {
+	_, err = s.db.Exec(s.db.Rebind("UPDATE channels SET paused_until_date = ?, version = version + 1 WHERE channel_id = ?"), pausedUntilUnixTime, channelID)
+	return
+}
 
-	_, err = db.Exec("UPDATE channels SET next_remove_date = ? WHERE channel_id = ?", nextRemoveDateUnixTime, channelID)
+// Resume deletion in channel. Channel is checked immediately and counts as active at resume date,
+// so it isn't deleted as inactive right after a long pause
+func (s *sqlStore) ResumeChannel(channelID string, resumeDateUnixTime int64) (err error) {
+	query := `
+		UPDATE channels
+		SET paused_until_date = 0, next_remove_date = 0, last_activity_date = ?, version = version + 1
+		WHERE channel_id = ?
+	`
+	_, err = s.db.Exec(s.db.Rebind(query), resumeDateUnixTime, channelID)
 	return
 }
+
+// Make all channels to be checked for outdated messages immediately
+func (s *sqlStore) RescheduleAllChannels() (channelsNumber int64, err error) {
+	result, err := s.db.Exec("UPDATE channels SET next_remove_date = 0, version = version + 1")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// State of channel after purge pass of the remover
+type PurgePassResult struct {
+	ChannelID            string
+	Version              int64 // Version of channel properties the pass was based on
+	LastActivityDateUnix int64
+	NextRemoveDateUnix   int64
+	DeadlineDateUnix     int64
+	IsChannelToDelete    bool // Channel is unavailable or inactive, its properties must be deleted
+}
+
+// Save state of channel after purge pass in one transaction.
+// Nothing is changed if the channel was changed or deleted after the pass read it (isApplied is false),
+// so the pass never overwrites changes made by commands and never restores deleted channel.
+// New messages don't change version, the latest activity is kept
+func (s *sqlStore) CompletePurgePass(result *PurgePassResult) (isApplied bool, err error) {
+	if !result.IsChannelToDelete {
+		// New messages are scheduled not earlier than the pass result, so only activity is merged
+		updateResult, err := s.completePurgePassStatement.Exec(
+			result.LastActivityDateUnix, result.LastActivityDateUnix, result.NextRemoveDateUnix, result.DeadlineDateUnix, result.ChannelID, result.Version)
+		if err != nil {
+			return false, err
+		}
+		return isRowAffected(updateResult)
+	}
+
+	err = s.inTransaction(func(transaction *sqlx.Tx) error {
+		deleteResult, err := transaction.Stmtx(s.deleteInactiveChannelStatement).Exec(result.ChannelID, result.Version, result.LastActivityDateUnix)
+		if err != nil {
+			return err
+		}
+		if isApplied, err = isRowAffected(deleteResult); err != nil || !isApplied {
+			return err
+		}
+
+		return deleteChannelDataInTransaction(transaction, result.ChannelID)
+	})
+	if err != nil {
+		return false, err
+	}
+	return isApplied, nil
+}
+
+// Check if statement changed any row
+func isRowAffected(result sql.Result) (isAffected bool, err error) {
+	rowsNumber, err := result.RowsAffected()
+	return rowsNumber > 0, err
+}
@@ -0,0 +1,36 @@
+package cpstorage
+
+// Settings of guilds (servers)
+
+import (
+	"database/sql"
+)
+
+// Get locale of bot replies in the guild. Empty if not set
+func (s *sqlStore) GetGuildLocale(guildID string) (locale string, err error) {
+	err = s.db.Get(&locale, s.db.Rebind("SELECT locale FROM guild_settings WHERE guild_id = ?"), guildID)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return
+}
+
+// Set locale of bot replies in the guild. Empty locale resets it
+func (s *sqlStore) SetGuildLocale(guildID string, locale string) (err error) {
+	if locale == "" {
+		_, err = s.db.Exec(s.db.Rebind("DELETE FROM guild_settings WHERE guild_id = ?"), guildID)
+		return
+	}
+
+	query := `
+		INSERT INTO guild_settings
+			(guild_id, locale)
+			VALUES (?, ?)
+		ON CONFLICT (guild_id) DO UPDATE SET
+			locale = excluded.locale
+	`
+	_, err = s.db.Exec(s.db.Rebind(query), guildID, locale)
+	return
+}
@@ -0,0 +1,33 @@
+package cpstorage
+
+// Heartbeats of bot processes
+
+import (
+	"database/sql"
+)
+
+// Save date (unix time) when the process was alive
+func (s *sqlStore) WriteHeartbeat(processID string, dateUnixTime int64) (err error) {
+	query := `
+		INSERT INTO heartbeats
+			(process_id, date)
+			VALUES (?, ?)
+		ON CONFLICT (process_id) DO UPDATE SET
+			date = excluded.date
+	`
+	_, err = s.db.Exec(s.db.Rebind(query), processID, dateUnixTime)
+	return
+}
+
+// Get date (unix time) when the process was alive last time. isFound is false if the process has never run
+func (s *sqlStore) GetHeartbeat(processID string) (dateUnixTime int64, isFound bool, err error) {
+	err = s.db.Get(&dateUnixTime, s.db.Rebind("SELECT date FROM heartbeats WHERE process_id = ?"), processID)
+
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	return dateUnixTime, true, nil
+}
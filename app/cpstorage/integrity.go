@@ -0,0 +1,30 @@
+package cpstorage
+
+// Checking integrity of SQLite database files
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Check SQLite database file with PRAGMA integrity_check. The file is opened read-only and is not migrated
+func CheckIntegrity(dbPath string) (err error) {
+	db, err := sqlx.Open("sqlite", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	var problems []string
+	err = db.Select(&problems, "PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("failed to check database: %w", err)
+	}
+
+	if len(problems) != 1 || problems[0] != "ok" {
+		return fmt.Errorf("database is corrupted: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package cpstorage
+
+// Versioned schema migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Migrations of each driver are in its own directory (migrations/sqlite, migrations/postgres).
+// They are applied in order of their version - number prefix of the file name (0001_name.sql)
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+// Key of PostgreSQL advisory lock taken while migrating. Any number, the same in all bot processes
+const postgresMigrationsLockID = 7031204560150942
+
+type migration struct {
+	version int
+	name    string
+	query   string
+}
+
+// Apply all migrations of the driver that are newer than the database schema version.
+// beforeMigrate is called with the current version if there are pending migrations (e.g. to backup database)
+func (s *sqlStore) migrate(driver string, beforeMigrate func(currentVersion int) error) (err error) {
+	migrations, err := loadMigrations(driver)
+	if err != nil {
+		return err
+	}
+
+	err = s.inTransaction(func(transaction *sqlx.Tx) error {
+		err := lockMigrationsInTransaction(transaction, driver)
+		if err != nil {
+			return err
+		}
+
+		_, err = transaction.Exec(`
+			CREATE TABLE IF NOT EXISTS schema_version (
+				version INTEGER PRIMARY KEY,
+				applied_date BIGINT
+			)
+		`)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	currentVersion, err := s.getSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	var pendingMigrations []migration
+	for _, migration := range migrations {
+		if migration.version > currentVersion {
+			pendingMigrations = append(pendingMigrations, migration)
+		}
+	}
+	if len(pendingMigrations) == 0 {
+		return nil
+	}
+
+	if beforeMigrate != nil {
+		err = beforeMigrate(currentVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, migration := range pendingMigrations {
+		isApplied, err := s.applyMigration(driver, migration)
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", migration.name, err)
+		}
+		if isApplied {
+			log.Printf("Database migrated to version %d (%s)", migration.version, migration.name)
+		}
+	}
+
+	return nil
+}
+
+// Read embedded migrations of the driver sorted by version
+func loadMigrations(driver string) (migrations []migration, err error) {
+	fileNames, err := fs.Glob(migrationsFS, "migrations/"+driver+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fileName := range fileNames {
+		name := path.Base(fileName)
+
+		versionStr, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name %s: %w", name, err)
+		}
+
+		query, err := migrationsFS.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration{version: version, name: name, query: string(query)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
+
+// Get version of the last applied migration. 0 if nothing is applied
+func (s *sqlStore) getSchemaVersion() (version int, err error) {
+	err = s.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return
+}
+
+// Check that the database schema is of the latest version of the driver migrations
+func (s *sqlStore) checkSchemaVersion(driver string) (err error) {
+	migrations, err := loadMigrations(driver)
+	if err != nil {
+		return err
+	}
+	latestVersion := migrations[len(migrations)-1].version
+
+	// Database created before migrations has no schema_version table
+	version, err := s.getSchemaVersion()
+	if err != nil {
+		return fmt.Errorf("%w: failed to get its version: %v", ErrSchemaVersion, err)
+	}
+	if version != latestVersion {
+		return fmt.Errorf("%w: version is %d, expected %d", ErrSchemaVersion, version, latestVersion)
+	}
+	return nil
+}
+
+// Apply migration and save its version as one transaction.
+// Migration already applied by another process sharing the database is skipped
+func (s *sqlStore) applyMigration(driver string, migration migration) (isApplied bool, err error) {
+	err = s.inTransaction(func(transaction *sqlx.Tx) error {
+		err := lockMigrationsInTransaction(transaction, driver)
+		if err != nil {
+			return err
+		}
+
+		// Version is read again under the lock, it could be changed while this process was waiting for it
+		var currentVersion int
+		err = transaction.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&currentVersion)
+		if err != nil || currentVersion >= migration.version {
+			return err
+		}
+
+		_, err = transaction.Exec(migration.query)
+		if err != nil {
+			return err
+		}
+
+		_, err = transaction.Exec(transaction.Rebind("INSERT INTO schema_version (version, applied_date) VALUES (?, ?)"), migration.version, time.Now().Unix())
+		isApplied = err == nil
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return isApplied, nil
+}
+
+// Serialize migrations of processes sharing the database until the end of the transaction.
+// Only PostgreSQL needs it, SQLite transactions of the bot take the database write lock at start
+func lockMigrationsInTransaction(transaction *sqlx.Tx, driver string) (err error) {
+	if driver != DriverPostgres {
+		return nil
+	}
+	_, err = transaction.Exec("SELECT pg_advisory_xact_lock($1)", postgresMigrationsLockID)
+	return err
+}
@@ -0,0 +1,187 @@
+package cpstorage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Database of the bot version before migrations: only channels table, without schema_version
+func writeLegacyDatabase(t *testing.T, dbPath string) {
+	t.Helper()
+
+	db, err := sqlx.Open("sqlite", "file:"+dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open legacy database: %v", err)
+	}
+	defer db.Close()
+
+	for _, query := range []string{
+		`CREATE TABLE IF NOT EXISTS channels (
+			channel_id TEXT PRIMARY KEY,
+			timeout REAL,
+			last_activity_date INTEGER,
+			next_remove_date INTEGER
+		)`,
+		"INSERT INTO channels VALUES ('c1', 1.5, 100, 200)",
+		"INSERT INTO channels VALUES ('c2', 24, 300, 400)",
+	} {
+		_, err = db.Exec(query)
+		if err != nil {
+			t.Fatalf("Failed to write legacy database: %v", err)
+		}
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "channels.db")
+	writeLegacyDatabase(t, dbPath)
+
+	Init(DriverSQLite, dbPath)
+	defer Close()
+
+	migrations, err := loadMigrations(DriverSQLite)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	latestVersion := migrations[len(migrations)-1].version
+
+	version, err := store.(*sqliteStore).getSchemaVersion()
+	if err != nil || version != latestVersion {
+		t.Fatalf("Schema version = %d, %v; want %d", version, err, latestVersion)
+	}
+
+	// Legacy data is kept, new columns get their defaults
+	channelProperties, err := GetChannelProperties("c1")
+	if err != nil || channelProperties == nil {
+		t.Fatalf("GetChannelProperties(c1) = %v, %v", channelProperties, err)
+	}
+	expected := ChannelPropertiesEntity{ChannelID: "c1", Timeout: 1.5, LastActivityDateUnix: 100, NextRemoveDateUnix: 200}
+	if *channelProperties != expected {
+		t.Fatalf("Migrated channel = %+v, want %+v", *channelProperties, expected)
+	}
+	channelsProperties, err := GetAllChannelsProperties()
+	if err != nil || len(channelsProperties) != 2 {
+		t.Fatalf("GetAllChannelsProperties = %d channels, %v; want 2", len(channelsProperties), err)
+	}
+
+	// Database is backed up before migration, the backup has the legacy schema and data
+	backupPaths, err := filepath.Glob(dbPath + ".v0-*.bak")
+	if err != nil || len(backupPaths) != 1 {
+		t.Fatalf("Backups before migration = %v, %v; want one", backupPaths, err)
+	}
+	backup, err := sqlx.Open("sqlite", "file:"+backupPaths[0])
+	if err != nil {
+		t.Fatalf("Failed to open backup: %v", err)
+	}
+	defer backup.Close()
+
+	var channelsNumber int
+	err = backup.Get(&channelsNumber, "SELECT COUNT(*) FROM channels")
+	if err != nil || channelsNumber != 2 {
+		t.Fatalf("Channels in backup = %d, %v; want 2", channelsNumber, err)
+	}
+
+	// schema_version is created before backup, but no migration is applied there yet
+	var appliedNumber int
+	err = backup.Get(&appliedNumber, "SELECT COUNT(*) FROM schema_version")
+	if err != nil || appliedNumber != 0 {
+		t.Fatalf("Applied migrations in backup = %d, %v; want 0", appliedNumber, err)
+	}
+}
+
+func TestOpenExistingRefusesOldSchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "channels.db")
+	writeLegacyDatabase(t, dbPath)
+
+	existingStore, err := NewExistingSQLiteStore(dbPath)
+	if !errors.Is(err, ErrSchemaVersion) {
+		if err == nil {
+			existingStore.Close()
+		}
+		t.Fatalf("NewExistingSQLiteStore of database without migrations returned %v, want ErrSchemaVersion", err)
+	}
+
+	// Database is neither migrated nor backed up
+	backupPaths, err := filepath.Glob(dbPath + ".*.bak")
+	if err != nil || len(backupPaths) != 0 {
+		t.Fatalf("Backups = %v, %v; want none", backupPaths, err)
+	}
+	db, err := sqlx.Open("sqlite", "file:"+dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	var isSchemaVersionExists bool
+	err = db.Get(&isSchemaVersionExists, "SELECT COUNT(*) > 0 FROM sqlite_master WHERE name = 'schema_version'")
+	if err != nil || isSchemaVersionExists {
+		t.Fatalf("schema_version table exists = %t, %v; want false", isSchemaVersionExists, err)
+	}
+
+	// Migrated database is opened
+	migratedStore, err := NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore returned error: %v", err)
+	}
+	migratedStore.Close()
+
+	existingStore, err = NewExistingSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewExistingSQLiteStore of migrated database returned error: %v", err)
+	}
+	defer existingStore.Close()
+	channelsProperties, err := existingStore.GetAllChannelsProperties()
+	if err != nil || len(channelsProperties) != 2 {
+		t.Fatalf("GetAllChannelsProperties = %d channels, %v; want 2", len(channelsProperties), err)
+	}
+}
+
+// Replicas sharing PostgreSQL database start together, each of them migrates it
+func TestMigratePostgresConcurrently(t *testing.T) {
+	dsn := os.Getenv(testPostgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testPostgresDSNEnv)
+	}
+
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+	for _, table := range append(testTables, "schema_version") {
+		_, err = db.Exec("DROP TABLE IF EXISTS " + table + " CASCADE")
+		if err != nil {
+			t.Fatalf("Failed to drop table %s: %v", table, err)
+		}
+	}
+
+	const replicasNumber = 4
+	errs := make(chan error, replicasNumber)
+	for range replicasNumber {
+		go func() {
+			store, err := NewPostgresStore(dsn)
+			if err == nil {
+				store.Close()
+			}
+			errs <- err
+		}()
+	}
+	for range replicasNumber {
+		if err := <-errs; err != nil {
+			t.Errorf("NewPostgresStore returned error: %v", err)
+		}
+	}
+
+	migrations, err := loadMigrations(DriverPostgres)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	var appliedNumber int
+	err = db.Get(&appliedNumber, "SELECT COUNT(*) FROM schema_version")
+	if err != nil || appliedNumber != len(migrations) {
+		t.Fatalf("Applied migrations = %d, %v; want %d", appliedNumber, err, len(migrations))
+	}
+}
@@ -0,0 +1,7 @@
+-- Initial schema
+CREATE TABLE IF NOT EXISTS channels (
+	channel_id TEXT PRIMARY KEY,
+	timeout DOUBLE PRECISION,
+	last_activity_date BIGINT,
+	next_remove_date BIGINT
+);
@@ -0,0 +1,3 @@
+-- Guild of the channel. Empty for channels saved before this migration until backfill resolves them
+ALTER TABLE channels ADD COLUMN guild_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS channels_guild_id ON channels (guild_id);
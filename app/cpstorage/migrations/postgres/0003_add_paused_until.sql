@@ -0,0 +1,2 @@
+-- Date (unixtime) until which deletion is paused. 0 - not paused
+ALTER TABLE channels ADD COLUMN paused_until_date BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+-- Per-user message lifetimes in channels. Override the channel timeout for messages of the user
+CREATE TABLE IF NOT EXISTS user_timeouts (
+	channel_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	timeout DOUBLE PRECISION NOT NULL,
+	PRIMARY KEY (channel_id, user_id)
+);
@@ -0,0 +1,5 @@
+-- Settings of guilds (servers)
+CREATE TABLE IF NOT EXISTS guild_settings (
+	guild_id TEXT PRIMARY KEY,
+	locale TEXT NOT NULL DEFAULT ''
+);
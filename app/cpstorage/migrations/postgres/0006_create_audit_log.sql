@@ -0,0 +1,13 @@
+-- Changes of channels settings made by users and by admin API
+CREATE TABLE IF NOT EXISTS audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	date BIGINT NOT NULL,
+	guild_id TEXT NOT NULL DEFAULT '',
+	channel_id TEXT NOT NULL DEFAULT '',
+	actor TEXT NOT NULL,
+	action TEXT NOT NULL,
+	details TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_guild_id ON audit_log (guild_id);
+CREATE INDEX IF NOT EXISTS audit_log_channel_id ON audit_log (channel_id);
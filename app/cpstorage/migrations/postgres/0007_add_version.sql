@@ -0,0 +1,2 @@
+-- Version of channel row. Increased on every change, used to detect concurrent changes
+ALTER TABLE channels ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
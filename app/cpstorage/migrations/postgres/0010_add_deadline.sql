@@ -0,0 +1,2 @@
+-- Date when the oldest message of channel waiting for deletion becomes too old for bulk delete. 0 - unknown
+ALTER TABLE channels ADD COLUMN deadline_date BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+-- Initial schema. Databases created before migrations already have this table
+CREATE TABLE IF NOT EXISTS channels (
+	channel_id TEXT PRIMARY KEY,
+	timeout REAL,
+	last_activity_date INTEGER,
+	next_remove_date INTEGER
+);
@@ -0,0 +1,13 @@
+-- Precise mode of channel. Every message is deleted exactly when it becomes outdated
+ALTER TABLE channels ADD COLUMN is_precise INTEGER NOT NULL DEFAULT 0;
+
+-- Messages of channels in precise mode waiting for deletion
+CREATE TABLE IF NOT EXISTS expiring_messages (
+	channel_id TEXT NOT NULL,
+	message_id TEXT NOT NULL,
+	author_id TEXT NOT NULL DEFAULT '',
+	expire_date INTEGER NOT NULL,
+	PRIMARY KEY (channel_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS expiring_messages_expire_date ON expiring_messages (expire_date);
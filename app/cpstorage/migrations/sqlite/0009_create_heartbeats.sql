@@ -0,0 +1,5 @@
+-- Last moments when remover loops of bot processes were alive. Used to detect downtime
+CREATE TABLE IF NOT EXISTS heartbeats (
+	process_id TEXT PRIMARY KEY,
+	date INTEGER NOT NULL
+);
@@ -0,0 +1,18 @@
+-- Threads with activity are archived instead of deleted together with their start messages
+ALTER TABLE channels ADD COLUMN is_archive_threads INTEGER NOT NULL DEFAULT 0;
+
+-- Threads of deleted messages waiting for cleanup, with outcome of every thread
+CREATE TABLE IF NOT EXISTS thread_cleanups (
+	thread_id TEXT PRIMARY KEY,
+	channel_id TEXT NOT NULL,
+	guild_id TEXT NOT NULL DEFAULT '',
+	is_archive INTEGER NOT NULL DEFAULT 0,
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_date INTEGER NOT NULL,
+	updated_date INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS thread_cleanups_status ON thread_cleanups (status);
+CREATE INDEX IF NOT EXISTS thread_cleanups_channel_id ON thread_cleanups (channel_id);
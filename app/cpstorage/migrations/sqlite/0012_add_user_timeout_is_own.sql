@@ -0,0 +1,2 @@
+-- Timeouts set by users for own messages can't be longer than the channel timeout
+ALTER TABLE user_timeouts ADD COLUMN is_own INTEGER NOT NULL DEFAULT 0;
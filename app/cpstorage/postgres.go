@@ -0,0 +1,70 @@
+package cpstorage
+
+// PostgreSQL storage. Shared database server, several bot replicas can use it
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+type postgresStore struct {
+	*sqlStore
+}
+
+// Connect to the database and migrate it to the current schema
+func NewPostgresStore(dsn string) (*postgresStore, error) {
+	store, err := connectPostgresStore(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.migrate(DriverPostgres, nil)
+	if err != nil {
+		store.db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	err = store.prepareStatements()
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to prepare statements: %w", err)
+	}
+
+	return store, nil
+}
+
+// Connect to the database without changing its schema. Fails if the schema is not of the current version
+func NewExistingPostgresStore(dsn string) (*postgresStore, error) {
+	store, err := connectPostgresStore(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.checkSchemaVersion(DriverPostgres)
+	if err != nil {
+		store.db.Close()
+		return nil, err
+	}
+
+	err = store.prepareStatements()
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to prepare statements: %w", err)
+	}
+
+	return store, nil
+}
+
+// Connect to the database
+func connectPostgresStore(dsn string) (*postgresStore, error) {
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return &postgresStore{
+		sqlStore: newSQLStore(db),
+	}, nil
+}
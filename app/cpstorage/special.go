@@ -2,32 +2,129 @@ package cpstorage
 
 // Special CRUD operations
 
-// Get channels with remove date before specified date (unix time)
-// These channels may contain outdated messages for removing
-func GetChannelsWithRemoveDateBeforeMoment(momentUnixTime int64) (channels []*ChannelPropertiesEntity, err error) {
-	dbLock.RLock()
-	defer dbLock.RUnlock()
+import (
+	"github.com/jmoiron/sqlx"
+)
 
+// Due channels, see GetChannelsWithRemoveDateBeforeMoment
+const (
+	dueChannelsCondition = "next_remove_date < ? AND paused_until_date <= ?"
+	dueChannelsOrder     = "ORDER BY CASE WHEN deadline_date = 0 THEN 1 ELSE 0 END, deadline_date, next_remove_date"
+	dueChannelsQuery     = "SELECT * FROM channels WHERE " + dueChannelsCondition + " " + dueChannelsOrder
+)
+
+// Shard of channel guild: (guild_id >> 22) % shard count. Channel with unknown guild belongs to shard 0
+const channelShardExpression = "CASE WHEN guild_id = '' THEN 0 ELSE (CAST(guild_id AS BIGINT) >> 22) % ? END"
+
+// Get channels of the shards with remove date before specified date (unix time)
+// These channels may contain outdated messages for removing.
+// Paused channels are skipped until their pause ends.
+// Channels are ordered by urgency: messages close to the bulk delete limit go first, channels with unknown deadline go last
+func (s *sqlStore) GetChannelsWithRemoveDateBeforeMoment(momentUnixTime int64, shards *ShardFilter) (channels []*ChannelPropertiesEntity, err error) {
+	if shards == nil {
+		err = s.dueChannelsStatement.Select(&channels, momentUnixTime, momentUnixTime)
+		return
+	}
+
+	query, args, err := sqlx.In("SELECT * FROM channels WHERE "+dueChannelsCondition+" AND "+channelShardExpression+" IN (?) "+dueChannelsOrder,
+		momentUnixTime, momentUnixTime, shards.Count, shards.IDs)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Select(&channels, s.db.Rebind(query), args...)
+
+	return
+}
+
+// Get channels IDs with remove date before specified date (unix time)
+// These channels may contain outdated messages for removing.
+// Paused channels are skipped until their pause ends
+func (s *sqlStore) GetChannelsIdsWithRemoveDateBeforeMoment(momentUnixTime int64) (channelIDs []string, err error) {
 	query := `
-        SELECT * FROM channels
-        WHERE next_remove_date < ?
+        SELECT channel_id FROM channels
+        WHERE next_remove_date < ? AND paused_until_date <= ?
     `
-	err = sqlxdb.Select(&channels, query, momentUnixTime)
+	err = s.db.Select(&channelIDs, s.db.Rebind(query), momentUnixTime, momentUnixTime)
 
 	return
 }
 
-// Get channels IDs with remove date before specified date (unix time)
-// These channels may contain outdated messages for removing
-func GetChannelsIdsWithRemoveDateBeforeMoment(momentUnixTime int64) (channelIDs []string, err error) {
-	dbLock.RLock()
-	defer dbLock.RUnlock()
+// Get properties of all channels in the guild
+func (s *sqlStore) GetGuildChannelsProperties(guildID string) (channelsProperties []*ChannelPropertiesEntity, err error) {
+	query := `
+        SELECT * FROM channels
+        WHERE guild_id = ?
+        ORDER BY channel_id
+    `
+	err = s.db.Select(&channelsProperties, s.db.Rebind(query), guildID)
+
+	return
+}
 
+// Get page of guild channels properties ordered by channel ID
+func (s *sqlStore) GetGuildChannelsPropertiesPage(guildID string, offset int, limit int) (channelsProperties []*ChannelPropertiesEntity, err error) {
 	query := `
-        SELECT channel_id FROM channels
-        WHERE next_remove_date < ?
+        SELECT * FROM channels
+        WHERE guild_id = ?
+        ORDER BY channel_id
+        LIMIT ? OFFSET ?
     `
-	err = sqlxdb.Select(&channelIDs, query, momentUnixTime)
+	err = s.db.Select(&channelsProperties, s.db.Rebind(query), guildID, limit, offset)
+
+	return
+}
+
+// Get number of channels with properties in the guild
+func (s *sqlStore) CountGuildChannelsProperties(guildID string) (count int, err error) {
+	err = s.db.Get(&count, s.db.Rebind("SELECT COUNT(*) FROM channels WHERE guild_id = ?"), guildID)
+	return
+}
+
+// Delete properties of all channels and settings of the guild
+func (s *sqlStore) DeleteGuildChannelsProperties(guildID string) (err error) {
+	return s.inTransaction(func(transaction *sqlx.Tx) error {
+		_, err := transaction.Exec(transaction.Rebind(`
+			DELETE FROM user_timeouts
+			WHERE channel_id IN (SELECT channel_id FROM channels WHERE guild_id = ?)
+		`), guildID)
+		if err != nil {
+			return err
+		}
+
+		_, err = transaction.Exec(transaction.Rebind(`
+			DELETE FROM expiring_messages
+			WHERE channel_id IN (SELECT channel_id FROM channels WHERE guild_id = ?)
+		`), guildID)
+		if err != nil {
+			return err
+		}
+
+		_, err = transaction.Exec(transaction.Rebind(`
+			DELETE FROM thread_cleanups
+			WHERE guild_id = ? OR channel_id IN (SELECT channel_id FROM channels WHERE guild_id = ?)
+		`), guildID, guildID)
+		if err != nil {
+			return err
+		}
+
+		_, err = transaction.Exec(transaction.Rebind("DELETE FROM channels WHERE guild_id = ?"), guildID)
+		if err != nil {
+			return err
+		}
+
+		_, err = transaction.Exec(transaction.Rebind("DELETE FROM guild_settings WHERE guild_id = ?"), guildID)
+		return err
+	})
+}
+
+// Get IDs of channels with unknown guild (saved before guild ID was stored)
+func (s *sqlStore) GetChannelsIdsWithoutGuild() (channelIDs []string, err error) {
+	err = s.db.Select(&channelIDs, "SELECT channel_id FROM channels WHERE guild_id = ''")
+	return
+}
 
+// Set guild ID for channel
+func (s *sqlStore) UpdateChannelGuild(channelID string, guildID string) (err error) {
+	_, err = s.db.Exec(s.db.Rebind("UPDATE channels SET guild_id = ?, version = version + 1 WHERE channel_id = ?"), guildID, channelID)
 	return
 }
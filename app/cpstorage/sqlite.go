@@ -0,0 +1,132 @@
+package cpstorage
+
+// SQLite storage. Single database file, only one bot process can use it
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	sqliteBusyTimeoutMs = 5000 // Time a connection waits for the writer to finish before failing with "database is locked"
+	sqliteMaxOpenConns  = 4    // WAL allows readers to work alongside the single writer
+)
+
+// Connection parameters applied to each connection of the pool:
+// WAL journal, so readers don't block the writer; writing transactions take the lock at start,
+// so they wait for each other with busy timeout instead of failing on lock upgrade
+var sqliteConnectionParams = fmt.Sprintf("_pragma=journal_mode(WAL)&_pragma=busy_timeout(%d)&_pragma=synchronous(NORMAL)&_txlock=immediate", sqliteBusyTimeoutMs)
+
+func init() {
+	// Driver of modernc.org/sqlite is unknown to sqlx, so Rebind wouldn't know its placeholders
+	sqlx.BindDriver("sqlite", sqlx.QUESTION)
+}
+
+type sqliteStore struct {
+	*sqlStore
+	dbPath string // Path to the database file
+}
+
+// Open database file (or create new) and migrate it to the current schema.
+// The database file is backed up before changing an existing schema
+func NewSQLiteStore(dbPath string) (*sqliteStore, error) {
+	store, err := openSQLiteStore(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.migrate(DriverSQLite, store.backupBeforeMigration)
+	if err != nil {
+		store.db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	err = store.prepareStatements()
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to prepare statements: %w", err)
+	}
+
+	return store, nil
+}
+
+// Open database file without changing its schema. Fails if the schema is not of the current version
+func NewExistingSQLiteStore(dbPath string) (*sqliteStore, error) {
+	store, err := openSQLiteStore(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.checkSchemaVersion(DriverSQLite)
+	if err != nil {
+		store.db.Close()
+		return nil, err
+	}
+
+	err = store.prepareStatements()
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to prepare statements: %w", err)
+	}
+
+	return store, nil
+}
+
+// Open connection pool of database file
+func openSQLiteStore(dbPath string) (*sqliteStore, error) {
+	db, err := sqlx.Open("sqlite", "file:"+dbPath+"?"+sqliteConnectionParams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(sqliteMaxOpenConns)
+	db.SetMaxIdleConns(sqliteMaxOpenConns)
+
+	return &sqliteStore{
+		sqlStore: newSQLStore(db),
+		dbPath:   dbPath,
+	}, nil
+}
+
+// Backup database if it already has data
+func (store *sqliteStore) backupBeforeMigration(currentVersion int) (err error) {
+	isSchemaExists, err := store.isTableExists("channels")
+	if err != nil || !isSchemaExists {
+		return err
+	}
+
+	backupPath := fmt.Sprintf("%s.v%d-%s.bak", store.dbPath, currentVersion, time.Now().Format("20060102-150405"))
+	err = store.Backup(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to backup database before migration: %w", err)
+	}
+	log.Printf("Database is backed up to %s", backupPath)
+
+	return nil
+}
+
+// Check if table exists in the database
+func (store *sqliteStore) isTableExists(tableName string) (isExists bool, err error) {
+	err = store.db.QueryRow("SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = ?", tableName).Scan(&isExists)
+	return
+}
+
+// Write consistent copy of the database to the file
+func (store *sqliteStore) Backup(backupPath string) (err error) {
+	if _, err = os.Stat(backupPath); err == nil {
+		return fmt.Errorf("backup file %s already exists", backupPath)
+	}
+
+	_, err = store.db.Exec("VACUUM INTO ?", backupPath)
+	return
+}
+
+// Rebuild the database file to reclaim unused space
+func (store *sqliteStore) Vacuum() (err error) {
+	_, err = store.db.Exec("VACUUM")
+	return
+}
@@ -0,0 +1,108 @@
+package cpstorage
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+const benchmarkChannelsNumber = 5000
+
+// Open SQLite store in a file, as the bot does, with many channels. Half of the channels are due at moment 1000
+func newBenchmarkSQLiteStore(b *testing.B) *sqliteStore {
+	b.Helper()
+
+	store, err := NewSQLiteStore(filepath.Join(b.TempDir(), "channels.db"))
+	if err != nil {
+		b.Fatalf("Failed to open database: %v", err)
+	}
+	b.Cleanup(func() { store.Close() })
+
+	channelsProperties := make([]*ChannelPropertiesEntity, benchmarkChannelsNumber)
+	for i := range channelsProperties {
+		channelsProperties[i] = &ChannelPropertiesEntity{
+			ChannelID:            benchmarkChannelID(i),
+			Timeout:              24,
+			LastActivityDateUnix: 100,
+			NextRemoveDateUnix:   int64(i % 2 * 2000),
+			GuildID:              fmt.Sprint(i % 50),
+		}
+	}
+	err = store.WriteChannelsProperties(channelsProperties)
+	if err != nil {
+		b.Fatalf("WriteChannelsProperties returned error: %v", err)
+	}
+	return store
+}
+
+func benchmarkChannelID(i int) string {
+	return fmt.Sprintf("channel%d", i)
+}
+
+// The remover selects due channels at the start of each pass
+func BenchmarkSQLiteDueChannels(b *testing.B) {
+	store := newBenchmarkSQLiteStore(b)
+	b.ResetTimer()
+
+	for range b.N {
+		channels, err := store.GetChannelsWithRemoveDateBeforeMoment(1000, nil)
+		if err != nil || len(channels) != benchmarkChannelsNumber/2 {
+			b.Fatalf("GetChannelsWithRemoveDateBeforeMoment = %d channels, %v", len(channels), err)
+		}
+	}
+}
+
+// The remover saves result of every processed channel
+func BenchmarkSQLiteCompletePurgePass(b *testing.B) {
+	store := newBenchmarkSQLiteStore(b)
+	channels, err := store.GetAllChannelsProperties()
+	if err != nil {
+		b.Fatalf("GetAllChannelsProperties returned error: %v", err)
+	}
+	b.ResetTimer()
+
+	for i := range b.N {
+		channelProperties := channels[i%len(channels)]
+		isApplied, err := store.CompletePurgePass(&PurgePassResult{
+			ChannelID:            channelProperties.ChannelID,
+			Version:              channelProperties.Version,
+			LastActivityDateUnix: channelProperties.LastActivityDateUnix,
+			NextRemoveDateUnix:   int64(i),
+		})
+		if err != nil || !isApplied {
+			b.Fatalf("CompletePurgePass = %t, %v", isApplied, err)
+		}
+		channelProperties.Version++
+	}
+}
+
+// New messages of many channels are saved alongside purge passes
+func BenchmarkSQLiteConcurrentWrites(b *testing.B) {
+	store := newBenchmarkSQLiteStore(b)
+	var writesNumber atomic.Int64
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := int(writesNumber.Add(1))
+			channelID := benchmarkChannelID(i % benchmarkChannelsNumber)
+
+			var err error
+			if i%2 == 0 {
+				err = store.ScheduleChannelMessage(channelID, int64(i), int64(i))
+			} else {
+				// Pass result may be rejected if the channel was changed after it was read, as in the remover
+				var channelProperties *ChannelPropertiesEntity
+				channelProperties, err = store.GetChannelProperties(channelID)
+				if err == nil {
+					_, err = store.CompletePurgePass(&PurgePassResult{ChannelID: channelID, Version: channelProperties.Version, NextRemoveDateUnix: int64(i)})
+				}
+			}
+			if err != nil {
+				b.Errorf("Write to channel %s returned error: %v", channelID, err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package cpstorage
+
+// Store implementation over database/sql, shared by SQLite and PostgreSQL.
+// Queries are written with "?" placeholders and rebound to the driver format
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type sqlStore struct {
+	db *sqlx.DB // Connection pool of the database
+
+	// Prepared statements of the remover hot path. It selects due channels and saves result of every processed channel
+	dueChannelsStatement           *sqlx.Stmt
+	completePurgePassStatement     *sqlx.Stmt
+	deleteInactiveChannelStatement *sqlx.Stmt
+}
+
+func newSQLStore(db *sqlx.DB) *sqlStore {
+	return &sqlStore{db: db}
+}
+
+// Prepare statements of the hot paths. Must be called after migration, as statements refer to tables
+func (s *sqlStore) prepareStatements() (err error) {
+	s.dueChannelsStatement, err = s.db.Preparex(s.db.Rebind(dueChannelsQuery))
+	if err != nil {
+		return err
+	}
+
+	s.completePurgePassStatement, err = s.db.Preparex(s.db.Rebind(completePurgePassQuery))
+	if err != nil {
+		return err
+	}
+
+	s.deleteInactiveChannelStatement, err = s.db.Preparex(s.db.Rebind(deleteInactiveChannelQuery))
+	return err
+}
+
+// Run function in transaction. Transaction is committed if function returns nil, otherwise it is rolled back
+func (s *sqlStore) inTransaction(fn func(transaction *sqlx.Tx) error) (err error) {
+	transaction, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			rolbackErr := transaction.Rollback()
+			if rolbackErr != nil {
+				err = fmt.Errorf("failed to rollback transcation %v, after write error: %v", rolbackErr, err)
+			}
+		} else {
+			err = transaction.Commit()
+		}
+	}()
+
+	return fn(transaction)
+}
+
+// Close connection to the database
+func (s *sqlStore) Close() (err error) {
+	for _, statement := range []*sqlx.Stmt{s.dueChannelsStatement, s.completePurgePassStatement, s.deleteInactiveChannelStatement} {
+		if statement != nil {
+			statement.Close()
+		}
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,660 @@
+package cpstorage
+
+// Conformance tests of Store. Every implementation must pass them.
+// PostgreSQL is tested only if CPSTORAGE_TEST_POSTGRES_DSN is set, its database is cleared before each test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+const testPostgresDSNEnv = "CPSTORAGE_TEST_POSTGRES_DSN"
+
+// Tables cleared before each PostgreSQL test
+var testTables = []string{"channels", "user_timeouts", "guild_settings", "audit_log", "expiring_messages", "heartbeats", "thread_cleanups"}
+
+// Run test against every store implementation
+func forEachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newTestSQLiteStore(t))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		test(t, newTestPostgresStore(t))
+	})
+}
+
+// Open migrated SQLite store in a file of the test directory, as the bot does (WAL, immediate transactions,
+// busy timeout). It is closed at the end of the test
+func newTestSQLiteStore(t testing.TB) *sqliteStore {
+	t.Helper()
+
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "channels.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// Open migrated and empty PostgreSQL store. Test is skipped if DSN is not set
+func newTestPostgresStore(t testing.TB) *postgresStore {
+	t.Helper()
+
+	dsn := os.Getenv(testPostgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testPostgresDSNEnv)
+	}
+
+	store, err := NewPostgresStore(dsn)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	for _, table := range testTables {
+		_, err = store.db.Exec("DELETE FROM " + table)
+		if err != nil {
+			t.Fatalf("Failed to clear table %s: %v", table, err)
+		}
+	}
+	return store
+}
+
+// Save channel properties or fail the test
+func mustWriteChannel(t testing.TB, store Store, channelProperties *ChannelPropertiesEntity) {
+	t.Helper()
+	err := store.WriteChannelProperties(channelProperties)
+	if err != nil {
+		t.Fatalf("WriteChannelProperties(%s) returned error: %v", channelProperties.ChannelID, err)
+	}
+}
+
+// Get channel properties or fail the test
+func mustGetChannel(t testing.TB, store Store, channelID string) *ChannelPropertiesEntity {
+	t.Helper()
+	channelProperties, err := store.GetChannelProperties(channelID)
+	if err != nil {
+		t.Fatalf("GetChannelProperties(%s) returned error: %v", channelID, err)
+	}
+	return channelProperties
+}
+
+func TestStoreChannelProperties(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		if channelProperties := mustGetChannel(t, store, "missing"); channelProperties != nil {
+			t.Fatalf("GetChannelProperties of missing channel = %+v, want nil", channelProperties)
+		}
+
+		written := &ChannelPropertiesEntity{
+			ChannelID:            "c1",
+			Timeout:              1.5,
+			LastActivityDateUnix: 100,
+			NextRemoveDateUnix:   200,
+			GuildID:              "g1",
+			PausedUntilDateUnix:  300,
+			IsPrecise:            true,
+			IsArchiveThreads:     true,
+		}
+		mustWriteChannel(t, store, written)
+
+		read := mustGetChannel(t, store, "c1")
+		if read == nil {
+			t.Fatal("Saved channel is not found")
+		}
+		read.Version = 0
+		if *read != *written {
+			t.Fatalf("Read channel %+v, want %+v", *read, *written)
+		}
+
+		// Save replaces all properties and changes version
+		version := mustGetChannel(t, store, "c1").Version
+		written.Timeout = 3
+		written.IsPrecise = false
+		mustWriteChannel(t, store, written)
+		read = mustGetChannel(t, store, "c1")
+		if read.Timeout != 3 || read.IsPrecise || read.Version <= version {
+			t.Fatalf("Channel after second save = %+v", *read)
+		}
+
+		err := store.WriteChannelsProperties([]*ChannelPropertiesEntity{
+			{ChannelID: "c2", Timeout: 2, GuildID: "g1"},
+			{ChannelID: "c3", Timeout: 3, GuildID: "g2"},
+		})
+		if err != nil {
+			t.Fatalf("WriteChannelsProperties returned error: %v", err)
+		}
+		all, err := store.GetAllChannelsProperties()
+		if err != nil || len(all) != 3 {
+			t.Fatalf("GetAllChannelsProperties = %d channels, %v; want 3", len(all), err)
+		}
+
+		guildChannels, err := store.GetGuildChannelsProperties("g1")
+		if err != nil || len(guildChannels) != 2 || guildChannels[0].ChannelID != "c1" || guildChannels[1].ChannelID != "c2" {
+			t.Fatalf("GetGuildChannelsProperties(g1) = %v, %v", guildChannels, err)
+		}
+		count, err := store.CountGuildChannelsProperties("g1")
+		if err != nil || count != 2 {
+			t.Fatalf("CountGuildChannelsProperties(g1) = %d, %v; want 2", count, err)
+		}
+		page, err := store.GetGuildChannelsPropertiesPage("g1", 1, 10)
+		if err != nil || len(page) != 1 || page[0].ChannelID != "c2" {
+			t.Fatalf("GetGuildChannelsPropertiesPage(g1, 1, 10) = %v, %v", page, err)
+		}
+
+		err = store.UpdateChannelLastActivityDate("c2", 500)
+		if err != nil {
+			t.Fatalf("UpdateChannelLastActivityDate returned error: %v", err)
+		}
+		err = store.UpdateChannelNextRemoveDate("c2", 600)
+		if err != nil {
+			t.Fatalf("UpdateChannelNextRemoveDate returned error: %v", err)
+		}
+		read = mustGetChannel(t, store, "c2")
+		if read.LastActivityDateUnix != 500 || read.NextRemoveDateUnix != 600 {
+			t.Fatalf("Channel after updates = %+v", *read)
+		}
+
+		err = store.DeleteChannelProperties("c1")
+		if err != nil {
+			t.Fatalf("DeleteChannelProperties returned error: %v", err)
+		}
+		err = store.DeleteChannelsProperties([]string{"c2", "missing"})
+		if err != nil {
+			t.Fatalf("DeleteChannelsProperties returned error: %v", err)
+		}
+		all, err = store.GetAllChannelsProperties()
+		if err != nil || len(all) != 1 || all[0].ChannelID != "c3" {
+			t.Fatalf("Channels after delete = %v, %v; want only c3", all, err)
+		}
+	})
+}
+
+func TestStoreScheduleChannelMessage(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "c", Timeout: 1, LastActivityDateUnix: 100, NextRemoveDateUnix: 1000})
+		version := mustGetChannel(t, store, "c").Version
+
+		// Earlier remove date is taken, later one is ignored. Activity only grows
+		for _, message := range []struct{ date, removeDate int64 }{{200, 800}, {150, 900}} {
+			err := store.ScheduleChannelMessage("c", message.date, message.removeDate)
+			if err != nil {
+				t.Fatalf("ScheduleChannelMessage returned error: %v", err)
+			}
+		}
+
+		read := mustGetChannel(t, store, "c")
+		if read.LastActivityDateUnix != 200 || read.NextRemoveDateUnix != 800 || read.Version != version {
+			t.Fatalf("Channel after new messages = %+v, want activity 200, next remove 800 and version %d", *read, version)
+		}
+	})
+}
+
+func TestStoreUserTimeouts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "c", Timeout: 10})
+
+		userTimeout, err := store.GetUserTimeout("c", "u1")
+		if err != nil || userTimeout != nil {
+			t.Fatalf("GetUserTimeout of missing timeout = %v, %v; want nil", userTimeout, err)
+		}
+
+		for _, userTimeout := range []*UserTimeoutEntity{
+			{ChannelID: "c", UserID: "u1", Timeout: 1},
+			{ChannelID: "c", UserID: "u2", Timeout: 2},
+			{ChannelID: "c", UserID: "u1", Timeout: 3, IsOwn: true}, // Replaces the first one
+		} {
+			err = store.WriteUserTimeout(userTimeout)
+			if err != nil {
+				t.Fatalf("WriteUserTimeout returned error: %v", err)
+			}
+		}
+
+		userTimeout, err = store.GetUserTimeout("c", "u1")
+		if err != nil || userTimeout == nil || userTimeout.Timeout != 3 || !userTimeout.IsOwn {
+			t.Fatalf("GetUserTimeout(c, u1) = %v, %v; want own timeout 3", userTimeout, err)
+		}
+		userTimeouts, err := store.GetChannelUserTimeouts("c")
+		if err != nil || len(userTimeouts) != 2 {
+			t.Fatalf("GetChannelUserTimeouts(c) = %v, %v; want 2 timeouts", userTimeouts, err)
+		}
+
+		err = store.DeleteUserTimeout("c", "u2")
+		if err != nil {
+			t.Fatalf("DeleteUserTimeout returned error: %v", err)
+		}
+		userTimeouts, _ = store.GetChannelUserTimeouts("c")
+		if len(userTimeouts) != 1 || userTimeouts[0].UserID != "u1" {
+			t.Fatalf("User timeouts after delete = %v, want only u1", userTimeouts)
+		}
+
+		// User timeouts belong to the channel
+		err = store.DeleteChannelProperties("c")
+		if err != nil {
+			t.Fatalf("DeleteChannelProperties returned error: %v", err)
+		}
+		userTimeouts, _ = store.GetChannelUserTimeouts("c")
+		if len(userTimeouts) != 0 {
+			t.Fatalf("User timeouts of deleted channel = %v, want none", userTimeouts)
+		}
+	})
+}
+
+func TestStoreGuildUserTimeouts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "c1", Timeout: 10, GuildID: "g1"})
+		mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "c2", Timeout: 10, GuildID: "g1"})
+		mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "c3", Timeout: 10, GuildID: "g2"})
+		for _, userTimeout := range []*UserTimeoutEntity{
+			{ChannelID: "c2", UserID: "u1", Timeout: 1},
+			{ChannelID: "c1", UserID: "u2", Timeout: 2},
+			{ChannelID: "c1", UserID: "u1", Timeout: 3},
+			{ChannelID: "c3", UserID: "u1", Timeout: 4},
+		} {
+			err := store.WriteUserTimeout(userTimeout)
+			if err != nil {
+				t.Fatalf("WriteUserTimeout returned error: %v", err)
+			}
+		}
+
+		userTimeouts, err := store.GetGuildUserTimeouts("g1")
+		if err != nil {
+			t.Fatalf("GetGuildUserTimeouts returned error: %v", err)
+		}
+		var keys []string
+		for _, userTimeout := range userTimeouts {
+			keys = append(keys, userTimeout.ChannelID+"/"+userTimeout.UserID)
+		}
+		if fmt.Sprint(keys) != "[c1/u1 c1/u2 c2/u1]" {
+			t.Fatalf("User timeouts of guild g1 = %v, want [c1/u1 c1/u2 c2/u1]", keys)
+		}
+
+		userTimeouts, err = store.GetChannelsUserTimeouts([]string{"c3", "c2"})
+		if err != nil {
+			t.Fatalf("GetChannelsUserTimeouts returned error: %v", err)
+		}
+		keys = nil
+		for _, userTimeout := range userTimeouts {
+			keys = append(keys, userTimeout.ChannelID+"/"+userTimeout.UserID)
+		}
+		if fmt.Sprint(keys) != "[c2/u1 c3/u1]" {
+			t.Fatalf("User timeouts of channels c3, c2 = %v, want [c2/u1 c3/u1]", keys)
+		}
+
+		userTimeouts, err = store.GetChannelsUserTimeouts(nil)
+		if err != nil || len(userTimeouts) != 0 {
+			t.Fatalf("GetChannelsUserTimeouts of no channels = %v, %v; want none", userTimeouts, err)
+		}
+	})
+}
+
+func TestStorePause(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "paused", Timeout: 1, NextRemoveDateUnix: 10})
+		mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "active", Timeout: 1, NextRemoveDateUnix: 10})
+
+		err := store.PauseChannel("paused", 1000)
+		if err != nil {
+			t.Fatalf("PauseChannel returned error: %v", err)
+		}
+		read := mustGetChannel(t, store, "paused")
+		if !read.IsPaused(999) || read.IsPaused(1000) {
+			t.Fatalf("Channel paused until 1000 = %+v", *read)
+		}
+
+		// Paused channel is not due until its pause ends
+		channelIDs, err := store.GetChannelsIdsWithRemoveDateBeforeMoment(500)
+		if err != nil || len(channelIDs) != 1 || channelIDs[0] != "active" {
+			t.Fatalf("Due channels during pause = %v, %v; want only active", channelIDs, err)
+		}
+		channelIDs, _ = store.GetChannelsIdsWithRemoveDateBeforeMoment(1000)
+		if len(channelIDs) != 2 {
+			t.Fatalf("Due channels after pause = %v, want both", channelIDs)
+		}
+
+		err = store.PauseChannel("paused", PausedIndefinitely)
+		if err != nil {
+			t.Fatalf("PauseChannel returned error: %v", err)
+		}
+		err = store.ResumeChannel("paused", 700)
+		if err != nil {
+			t.Fatalf("ResumeChannel returned error: %v", err)
+		}
+		read = mustGetChannel(t, store, "paused")
+		if read.PausedUntilDateUnix != 0 || read.NextRemoveDateUnix != 0 || read.LastActivityDateUnix != 700 {
+			t.Fatalf("Resumed channel = %+v, want not paused, due now and active at 700", *read)
+		}
+	})
+}
+
+func TestStoreDueChannelsOrder(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		for _, channelProperties := range []*ChannelPropertiesEntity{
+			{ChannelID: "late", Timeout: 1, NextRemoveDateUnix: 5},
+			{ChannelID: "unknown", Timeout: 1, NextRemoveDateUnix: 0},
+			{ChannelID: "early", Timeout: 1, NextRemoveDateUnix: 8},
+			{ChannelID: "not-due", Timeout: 1, NextRemoveDateUnix: 100},
+		} {
+			mustWriteChannel(t, store, channelProperties)
+		}
+		for channelID, deadline := range map[string]int64{"late": 900, "early": 500} {
+			_, err := store.CompletePurgePass(&PurgePassResult{
+				ChannelID:          channelID,
+				Version:            mustGetChannel(t, store, channelID).Version,
+				NextRemoveDateUnix: mustGetChannel(t, store, channelID).NextRemoveDateUnix,
+				DeadlineDateUnix:   deadline,
+			})
+			if err != nil {
+				t.Fatalf("CompletePurgePass returned error: %v", err)
+			}
+		}
+
+		channels, err := store.GetChannelsWithRemoveDateBeforeMoment(50, nil)
+		if err != nil {
+			t.Fatalf("GetChannelsWithRemoveDateBeforeMoment returned error: %v", err)
+		}
+		var channelIDs []string
+		for _, channel := range channels {
+			channelIDs = append(channelIDs, channel.ChannelID)
+		}
+		if fmt.Sprint(channelIDs) != "[early late unknown]" {
+			t.Fatalf("Due channels = %v, want [early late unknown]", channelIDs)
+		}
+	})
+}
+
+// Due channels are filtered by shard of their guild, as Discord calculates it
+func TestStoreDueChannelsOfShards(t *testing.T) {
+	const shardCount = 4
+	guildIDs := []string{"", "4194304", "12582912", "1234567890123456789", "9223372036854775807"}
+
+	forEachStore(t, func(t *testing.T, store Store) {
+		expectedShards := map[string]int{}
+		for i, guildID := range guildIDs {
+			channelID := fmt.Sprintf("c%d", i)
+			mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: channelID, Timeout: 1, GuildID: guildID})
+			mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: channelID + "-not-due", Timeout: 1, GuildID: guildID, NextRemoveDateUnix: 100})
+
+			if guildID != "" {
+				id, err := strconv.ParseUint(guildID, 10, 64)
+				if err != nil {
+					t.Fatalf("Invalid guild ID %s: %v", guildID, err)
+				}
+				expectedShards[channelID] = int((id >> 22) % shardCount)
+			}
+		}
+
+		for _, shardIDs := range [][]int{{0}, {1}, {2, 3}, {0, 1, 2, 3}} {
+			channels, err := store.GetChannelsWithRemoveDateBeforeMoment(50, &ShardFilter{Count: shardCount, IDs: shardIDs})
+			if err != nil {
+				t.Fatalf("GetChannelsWithRemoveDateBeforeMoment(shards %v) returned error: %v", shardIDs, err)
+			}
+
+			var channelIDs, expectedChannelIDs []string
+			for _, channel := range channels {
+				channelIDs = append(channelIDs, channel.ChannelID)
+			}
+			for i := range guildIDs {
+				channelID := fmt.Sprintf("c%d", i)
+				if slices.Contains(shardIDs, expectedShards[channelID]) {
+					expectedChannelIDs = append(expectedChannelIDs, channelID)
+				}
+			}
+			slices.Sort(channelIDs)
+			if !slices.Equal(channelIDs, expectedChannelIDs) {
+				t.Errorf("Due channels of shards %v = %v, want %v", shardIDs, channelIDs, expectedChannelIDs)
+			}
+		}
+	})
+}
+
+func TestStoreCompletePurgePass(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "c", Timeout: 1, LastActivityDateUnix: 100})
+		version := mustGetChannel(t, store, "c").Version
+
+		isApplied, err := store.CompletePurgePass(&PurgePassResult{
+			ChannelID:            "c",
+			Version:              version,
+			LastActivityDateUnix: 150,
+			NextRemoveDateUnix:   400,
+			DeadlineDateUnix:     900,
+		})
+		if err != nil || !isApplied {
+			t.Fatalf("CompletePurgePass = %t, %v; want applied", isApplied, err)
+		}
+		read := mustGetChannel(t, store, "c")
+		if read.LastActivityDateUnix != 150 || read.NextRemoveDateUnix != 400 || read.DeadlineDateUnix != 900 || read.Version <= version {
+			t.Fatalf("Channel after pass = %+v", *read)
+		}
+
+		// Inactive channel is deleted with its data
+		err = store.WriteUserTimeout(&UserTimeoutEntity{ChannelID: "c", UserID: "u", Timeout: 1})
+		if err != nil {
+			t.Fatalf("WriteUserTimeout returned error: %v", err)
+		}
+		isApplied, err = store.CompletePurgePass(&PurgePassResult{
+			ChannelID:            "c",
+			Version:              read.Version,
+			LastActivityDateUnix: read.LastActivityDateUnix,
+			IsChannelToDelete:    true,
+		})
+		if err != nil || !isApplied {
+			t.Fatalf("CompletePurgePass deleting channel = %t, %v; want applied", isApplied, err)
+		}
+		if read := mustGetChannel(t, store, "c"); read != nil {
+			t.Fatalf("Deleted channel = %+v, want nil", *read)
+		}
+		userTimeouts, _ := store.GetChannelUserTimeouts("c")
+		if len(userTimeouts) != 0 {
+			t.Fatalf("User timeouts of deleted channel = %v, want none", userTimeouts)
+		}
+	})
+}
+
+// Commands change the channel after the remover read it and before the pass result is saved
+func TestStoreCompletePurgePassRace(t *testing.T) {
+	commands := []struct {
+		name  string
+		run   func(store Store) error
+		check func(t *testing.T, channelProperties *ChannelPropertiesEntity)
+	}{
+		{
+			name: "set-timeout",
+			run: func(store Store) error {
+				return store.WriteChannelProperties(&ChannelPropertiesEntity{ChannelID: "c", Timeout: 5, LastActivityDateUnix: 120, NextRemoveDateUnix: 0})
+			},
+			check: func(t *testing.T, channelProperties *ChannelPropertiesEntity) {
+				if channelProperties == nil || channelProperties.Timeout != 5 || channelProperties.NextRemoveDateUnix != 0 {
+					t.Fatalf("Channel = %+v, want timeout 5 to be checked now", channelProperties)
+				}
+			},
+		},
+		{
+			name: "pause",
+			run: func(store Store) error {
+				return store.PauseChannel("c", PausedIndefinitely)
+			},
+			check: func(t *testing.T, channelProperties *ChannelPropertiesEntity) {
+				if channelProperties == nil || channelProperties.PausedUntilDateUnix != PausedIndefinitely || channelProperties.NextRemoveDateUnix != 10 {
+					t.Fatalf("Channel = %+v, want paused and not rescheduled", channelProperties)
+				}
+			},
+		},
+		{
+			name: "remove-timeout",
+			run: func(store Store) error {
+				return store.DeleteChannelProperties("c")
+			},
+			check: func(t *testing.T, channelProperties *ChannelPropertiesEntity) {
+				if channelProperties != nil {
+					t.Fatalf("Channel = %+v, want deleted channel not to be restored", *channelProperties)
+				}
+			},
+		},
+	}
+
+	for _, command := range commands {
+		for _, isChannelToDelete := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/delete=%t", command.name, isChannelToDelete), func(t *testing.T) {
+				forEachStore(t, func(t *testing.T, store Store) {
+					mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "c", Timeout: 1, LastActivityDateUnix: 100, NextRemoveDateUnix: 10})
+					passChannel := mustGetChannel(t, store, "c")
+
+					err := command.run(store)
+					if err != nil {
+						t.Fatalf("Command returned error: %v", err)
+					}
+
+					isApplied, err := store.CompletePurgePass(&PurgePassResult{
+						ChannelID:            "c",
+						Version:              passChannel.Version,
+						LastActivityDateUnix: passChannel.LastActivityDateUnix,
+						NextRemoveDateUnix:   500,
+						DeadlineDateUnix:     900,
+						IsChannelToDelete:    isChannelToDelete,
+					})
+					if err != nil || isApplied {
+						t.Fatalf("CompletePurgePass = %t, %v; want not applied", isApplied, err)
+					}
+					command.check(t, mustGetChannel(t, store, "c"))
+				})
+			})
+		}
+	}
+}
+
+// New messages don't conflict with the pass, their activity and earlier remove date are kept
+func TestStoreCompletePurgePassWithNewMessage(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "c", Timeout: 1, LastActivityDateUnix: 100, NextRemoveDateUnix: 10})
+		passChannel := mustGetChannel(t, store, "c")
+
+		err := store.ScheduleChannelMessage("c", 200, 300)
+		if err != nil {
+			t.Fatalf("ScheduleChannelMessage returned error: %v", err)
+		}
+
+		// Inactive channel becomes active again with the message
+		isApplied, err := store.CompletePurgePass(&PurgePassResult{
+			ChannelID:            "c",
+			Version:              passChannel.Version,
+			LastActivityDateUnix: passChannel.LastActivityDateUnix,
+			IsChannelToDelete:    true,
+		})
+		if err != nil || isApplied {
+			t.Fatalf("CompletePurgePass deleting channel = %t, %v; want not applied", isApplied, err)
+		}
+
+		isApplied, err = store.CompletePurgePass(&PurgePassResult{
+			ChannelID:            "c",
+			Version:              passChannel.Version,
+			LastActivityDateUnix: 150,
+			NextRemoveDateUnix:   250,
+		})
+		if err != nil || !isApplied {
+			t.Fatalf("CompletePurgePass = %t, %v; want applied", isApplied, err)
+		}
+		read := mustGetChannel(t, store, "c")
+		if read.LastActivityDateUnix != 200 || read.NextRemoveDateUnix != 250 {
+			t.Fatalf("Channel = %+v, want activity 200 of the message and next remove 250", *read)
+		}
+	})
+}
+
+// Queue thread cleanup of the channel or fail the test
+func mustEnqueueThreadCleanup(t testing.TB, store Store, threadID string, channelID string, guildID string) {
+	t.Helper()
+	err := store.EnqueueThreadCleanups([]*ThreadCleanupEntity{{ThreadID: threadID, ChannelID: channelID, GuildID: guildID}})
+	if err != nil {
+		t.Fatalf("EnqueueThreadCleanups returned error: %v", err)
+	}
+}
+
+// Check which of the threads are still queued
+func assertThreadCleanups(t testing.TB, store Store, queuedThreadIDs map[string]bool) {
+	t.Helper()
+	for threadID, isQueued := range queuedThreadIDs {
+		threadCleanup, err := store.GetThreadCleanup(threadID)
+		if err != nil {
+			t.Fatalf("GetThreadCleanup(%s) returned error: %v", threadID, err)
+		}
+		if (threadCleanup != nil) != isQueued {
+			t.Errorf("Thread %s is queued = %t, want %t", threadID, threadCleanup != nil, isQueued)
+		}
+	}
+}
+
+// Thread cleanups are deleted together with their channel
+func TestStoreThreadCleanupsOfDeletedChannels(t *testing.T) {
+	t.Run("channel", func(t *testing.T) {
+		forEachStore(t, func(t *testing.T, store Store) {
+			mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "c1", Timeout: 1})
+			mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "c2", Timeout: 1})
+			mustEnqueueThreadCleanup(t, store, "t1", "c1", "")
+			mustEnqueueThreadCleanup(t, store, "t2", "c2", "")
+
+			err := store.DeleteChannelProperties("c1")
+			if err != nil {
+				t.Fatalf("DeleteChannelProperties returned error: %v", err)
+			}
+			assertThreadCleanups(t, store, map[string]bool{"t1": false, "t2": true})
+		})
+	})
+
+	t.Run("inactive channel", func(t *testing.T) {
+		forEachStore(t, func(t *testing.T, store Store) {
+			mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "c", Timeout: 1, LastActivityDateUnix: 100})
+			mustEnqueueThreadCleanup(t, store, "t", "c", "")
+			read := mustGetChannel(t, store, "c")
+
+			isApplied, err := store.CompletePurgePass(&PurgePassResult{ChannelID: "c", Version: read.Version, LastActivityDateUnix: 100, IsChannelToDelete: true})
+			if err != nil || !isApplied {
+				t.Fatalf("CompletePurgePass deleting channel = %t, %v; want applied", isApplied, err)
+			}
+			assertThreadCleanups(t, store, map[string]bool{"t": false})
+		})
+	})
+
+	t.Run("guild", func(t *testing.T) {
+		forEachStore(t, func(t *testing.T, store Store) {
+			mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "c1", Timeout: 1, GuildID: "g1"})
+			mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "c2", Timeout: 1, GuildID: "g2"})
+			mustEnqueueThreadCleanup(t, store, "t1", "c1", "")
+			mustEnqueueThreadCleanup(t, store, "t2", "removed", "g1")
+			mustEnqueueThreadCleanup(t, store, "t3", "c2", "g2")
+
+			err := store.DeleteGuildChannelsProperties("g1")
+			if err != nil {
+				t.Fatalf("DeleteGuildChannelsProperties returned error: %v", err)
+			}
+			assertThreadCleanups(t, store, map[string]bool{"t1": false, "t2": false, "t3": true})
+		})
+	})
+
+	t.Run("import", func(t *testing.T) {
+		forEachStore(t, func(t *testing.T, store Store) {
+			mustWriteChannel(t, store, &ChannelPropertiesEntity{ChannelID: "c", Timeout: 1})
+			mustEnqueueThreadCleanup(t, store, "t1", "c", "")
+			document := &ExportDocument{Version: ExportVersion, Channels: []*ExportChannel{{ChannelID: "c", Timeout: 2}}}
+
+			err := store.Import(document, ImportMerge)
+			if err != nil {
+				t.Fatalf("Import in merge mode returned error: %v", err)
+			}
+			assertThreadCleanups(t, store, map[string]bool{"t1": true})
+
+			// Replace clears the whole table, even for channels that are imported again
+			mustEnqueueThreadCleanup(t, store, "t2", "other", "")
+			err = store.Import(document, ImportReplace)
+			if err != nil {
+				t.Fatalf("Import in replace mode returned error: %v", err)
+			}
+			assertThreadCleanups(t, store, map[string]bool{"t1": false, "t2": false})
+		})
+	})
+}
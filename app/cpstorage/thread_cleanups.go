@@ -0,0 +1,116 @@
+package cpstorage
+
+// Threads of deleted messages waiting for cleanup and outcomes of their cleanup
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	ThreadCleanupPending  = "pending"  // Thread is waiting for the next attempt
+	ThreadCleanupDeleted  = "deleted"  // Thread is deleted
+	ThreadCleanupArchived = "archived" // Thread had activity and is archived instead of deleted
+	ThreadCleanupGone     = "gone"     // Thread was already deleted by someone else
+	ThreadCleanupFailed   = "failed"   // All attempts failed, thread is left as is
+)
+
+type ThreadCleanupEntity struct {
+	ThreadID            string `db:"thread_id"`         // Thread ID
+	ChannelID           string `db:"channel_id"`        // Channel of the deleted start message
+	GuildID             string `db:"guild_id"`          // Guild of the channel. Empty if unknown
+	IsArchive           bool   `db:"is_archive"`        // Thread with activity is archived instead of deleted
+	Status              string `db:"status"`            // One of ThreadCleanup statuses
+	Attempts            int    `db:"attempts"`          // Number of failed attempts
+	LastError           string `db:"last_error"`        // Error of the last failed attempt
+	NextAttemptDateUnix int64  `db:"next_attempt_date"` // Date (unixtime) of the next attempt of pending cleanup
+	UpdatedDateUnix     int64  `db:"updated_date"`      // Date (unixtime) of the last change
+}
+
+// Save new pending thread cleanups. Already saved threads are not changed
+func (s *sqlStore) EnqueueThreadCleanups(threadCleanups []*ThreadCleanupEntity) (err error) {
+	if len(threadCleanups) == 0 {
+		return nil
+	}
+
+	return s.inTransaction(func(transaction *sqlx.Tx) error {
+		query := `
+			INSERT INTO thread_cleanups
+				(thread_id, channel_id, guild_id, is_archive, status, next_attempt_date, updated_date)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (thread_id) DO NOTHING
+		`
+		statement, err := transaction.Preparex(transaction.Rebind(query))
+		if err != nil {
+			return err
+		}
+		defer statement.Close()
+
+		for _, threadCleanup := range threadCleanups {
+			_, err = statement.Exec(threadCleanup.ThreadID, threadCleanup.ChannelID, threadCleanup.GuildID, threadCleanup.IsArchive,
+				ThreadCleanupPending, threadCleanup.NextAttemptDateUnix, threadCleanup.UpdatedDateUnix)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Get all pending thread cleanups
+func (s *sqlStore) GetPendingThreadCleanups() (threadCleanups []*ThreadCleanupEntity, err error) {
+	err = s.db.Select(&threadCleanups, s.db.Rebind("SELECT * FROM thread_cleanups WHERE status = ?"), ThreadCleanupPending)
+	return
+}
+
+// Get thread cleanup. Returns nil if thread is not queued
+func (s *sqlStore) GetThreadCleanup(threadID string) (threadCleanup *ThreadCleanupEntity, err error) {
+	threadCleanup = &ThreadCleanupEntity{}
+	err = s.db.Get(threadCleanup, s.db.Rebind("SELECT * FROM thread_cleanups WHERE thread_id = ?"), threadID)
+
+	if err == sql.ErrNoRows {
+		err = nil
+		threadCleanup = nil
+	}
+
+	return
+}
+
+// Get thread cleanups of channel, from the latest changed
+func (s *sqlStore) GetChannelThreadCleanups(channelID string) (threadCleanups []*ThreadCleanupEntity, err error) {
+	query := "SELECT * FROM thread_cleanups WHERE channel_id = ? ORDER BY updated_date DESC, thread_id"
+	err = s.db.Select(&threadCleanups, s.db.Rebind(query), channelID)
+	return
+}
+
+// Save status, attempts, error and next attempt date of thread cleanup
+func (s *sqlStore) UpdateThreadCleanup(threadCleanup *ThreadCleanupEntity) (err error) {
+	query := `
+		UPDATE thread_cleanups SET
+			status = ?,
+			attempts = ?,
+			last_error = ?,
+			next_attempt_date = ?,
+			updated_date = ?
+		WHERE thread_id = ?
+	`
+	_, err = s.db.Exec(s.db.Rebind(query),
+		threadCleanup.Status,
+		threadCleanup.Attempts,
+		threadCleanup.LastError,
+		threadCleanup.NextAttemptDateUnix,
+		threadCleanup.UpdatedDateUnix,
+		threadCleanup.ThreadID)
+	return
+}
+
+// Delete finished thread cleanups changed before specified date (unix time)
+func (s *sqlStore) DeleteFinishedThreadCleanups(beforeUnixTime int64) (deletedNumber int64, err error) {
+	result, err := s.db.Exec(s.db.Rebind("DELETE FROM thread_cleanups WHERE status <> ? AND updated_date < ?"), ThreadCleanupPending, beforeUnixTime)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
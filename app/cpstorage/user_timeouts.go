@@ -0,0 +1,81 @@
+package cpstorage
+
+// Per-user message lifetimes in channels
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type UserTimeoutEntity struct {
+	ChannelID string  `db:"channel_id"` // Channel ID
+	UserID    string  `db:"user_id"`    // ID of the user (message author)
+	Timeout   float64 `db:"timeout"`    // Time (hours) after which messages of the user are deleted after sending
+	IsOwn     bool    `db:"is_own"`     // Timeout is set by the user. It can't be longer than the channel timeout
+}
+
+// Save user timeout in channel
+func (s *sqlStore) WriteUserTimeout(userTimeout *UserTimeoutEntity) (err error) {
+	query := `
+		INSERT INTO user_timeouts
+			(channel_id, user_id, timeout, is_own)
+			VALUES (?, ?, ?, ?)
+		ON CONFLICT (channel_id, user_id) DO UPDATE SET
+			timeout = excluded.timeout,
+			is_own = excluded.is_own
+	`
+	_, err = s.db.Exec(s.db.Rebind(query), userTimeout.ChannelID, userTimeout.UserID, userTimeout.Timeout, userTimeout.IsOwn)
+	return
+}
+
+// Delete user timeout in channel
+func (s *sqlStore) DeleteUserTimeout(channelID string, userID string) (err error) {
+	_, err = s.db.Exec(s.db.Rebind("DELETE FROM user_timeouts WHERE channel_id = ? AND user_id = ?"), channelID, userID)
+	return
+}
+
+// Get user timeout in channel. Returns nil if user has no own timeout
+func (s *sqlStore) GetUserTimeout(channelID string, userID string) (userTimeout *UserTimeoutEntity, err error) {
+	userTimeout = &UserTimeoutEntity{}
+	err = s.db.Get(userTimeout, s.db.Rebind("SELECT * FROM user_timeouts WHERE channel_id = ? AND user_id = ?"), channelID, userID)
+
+	if err == sql.ErrNoRows {
+		err = nil
+		userTimeout = nil
+	}
+
+	return
+}
+
+// Get timeouts of all users in channel
+func (s *sqlStore) GetChannelUserTimeouts(channelID string) (userTimeouts []*UserTimeoutEntity, err error) {
+	err = s.db.Select(&userTimeouts, s.db.Rebind("SELECT * FROM user_timeouts WHERE channel_id = ?"), channelID)
+	return
+}
+
+// Get timeouts of all users in all channels of the guild, ordered by channel
+func (s *sqlStore) GetGuildUserTimeouts(guildID string) (userTimeouts []*UserTimeoutEntity, err error) {
+	query := `
+		SELECT user_timeouts.* FROM user_timeouts
+		JOIN channels ON channels.channel_id = user_timeouts.channel_id
+		WHERE channels.guild_id = ?
+		ORDER BY user_timeouts.channel_id, user_timeouts.user_id
+	`
+	err = s.db.Select(&userTimeouts, s.db.Rebind(query), guildID)
+	return
+}
+
+// Get timeouts of all users in the channels, ordered by channel
+func (s *sqlStore) GetChannelsUserTimeouts(channelIDs []string) (userTimeouts []*UserTimeoutEntity, err error) {
+	if len(channelIDs) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In("SELECT * FROM user_timeouts WHERE channel_id IN (?) ORDER BY channel_id, user_id", channelIDs)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Select(&userTimeouts, s.db.Rebind(query), args...)
+	return
+}
@@ -0,0 +1,92 @@
+package main
+
+// Bulk delete deadlines. Discord doesn't bulk delete messages older than 14 days, so they must be deleted before
+
+import (
+	"expvar"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+const deadlineRiskWindow = 24 * time.Hour // Channels with backlog and deadline nearer than this are reported
+
+var (
+	dueChannelsMetric     = expvar.NewInt("remover_due_channels")             // Channels of this process waiting for check
+	nearDeadlineMetric    = expvar.NewInt("remover_channels_near_deadline")   // Due channels with deadline nearer than deadlineRiskWindow
+	missedDeadlineMetric  = expvar.NewInt("remover_channels_missed_deadline") // Due channels with deadline already passed
+	nearestDeadlineMetric = expvar.NewInt("remover_nearest_deadline")         // The nearest known deadline (unixtime) of due channels. 0 - none
+)
+
+// Get date when message sent at the date becomes too old for bulk delete
+func getBulkDeleteDeadline(sendDate time.Time) time.Time {
+	return sendDate.Add(time.Hour * time.Duration(currentConfig().OldDontRemoveTimeoutHours))
+}
+
+// Get deadline of channel. If it is not saved, it is estimated by the next remove date.
+// Channels checked as soon as possible (e.g. new ones) have unknown deadline, it is the zero date
+func getChannelDeadlineDate(channelProperties *cpstorage.ChannelPropertiesEntity) (deadlineDate time.Time, isKnown bool) {
+	if channelProperties.DeadlineDateUnix != 0 {
+		return time.Unix(channelProperties.DeadlineDateUnix, 0), true
+	} else if channelProperties.NextRemoveDateUnix == 0 {
+		return time.Time{}, false
+	}
+
+	// The oldest message waiting for deletion was sent about timeout before the scheduled check
+	oldestMessageDate := time.Unix(channelProperties.NextRemoveDateUnix, 0).Add(-time.Duration(channelProperties.Timeout * float64(time.Hour)))
+	return getBulkDeleteDeadline(oldestMessageDate), true
+}
+
+// Sort channels from the nearest deadline as in usual passes. Channels with unknown deadline go last
+func sortChannelsByDeadline(channelsProperties []*cpstorage.ChannelPropertiesEntity) {
+	sort.SliceStable(channelsProperties, func(i, j int) bool {
+		deadlineDate1, isKnown1 := getChannelDeadlineDate(channelsProperties[i])
+		deadlineDate2, isKnown2 := getChannelDeadlineDate(channelsProperties[j])
+		if isKnown1 != isKnown2 {
+			return isKnown1
+		} else if !deadlineDate1.Equal(deadlineDate2) {
+			return deadlineDate1.Before(deadlineDate2)
+		}
+		return channelsProperties[i].NextRemoveDateUnix < channelsProperties[j].NextRemoveDateUnix
+	})
+}
+
+// Update metrics of due channels of this process. Channels with unknown deadline are only counted as due
+func updateDeadlineMetrics(dueChannels []*cpstorage.ChannelPropertiesEntity) {
+	var nearDeadlineNumber, missedDeadlineNumber, nearestDeadlineUnix int64
+	for _, channelProperties := range dueChannels {
+		deadlineDate, isKnown := getChannelDeadlineDate(channelProperties)
+		if !isKnown {
+			continue
+		}
+
+		if time.Until(deadlineDate) < 0 {
+			missedDeadlineNumber++
+		} else if time.Until(deadlineDate) < deadlineRiskWindow {
+			nearDeadlineNumber++
+		}
+		if nearestDeadlineUnix == 0 || deadlineDate.Unix() < nearestDeadlineUnix {
+			nearestDeadlineUnix = deadlineDate.Unix()
+		}
+	}
+
+	dueChannelsMetric.Set(int64(len(dueChannels)))
+	nearDeadlineMetric.Set(nearDeadlineNumber)
+	missedDeadlineMetric.Set(missedDeadlineNumber)
+	nearestDeadlineMetric.Set(nearestDeadlineUnix)
+}
+
+// Warn if outdated messages are left in channel after pass and they may become too old for bulk delete
+func warnIfDeadlineAtRisk(channelProperties *cpstorage.ChannelPropertiesEntity, isBacklogLeft bool) {
+	if !isBacklogLeft {
+		return
+	}
+
+	deadlineDate, isKnown := getChannelDeadlineDate(channelProperties)
+	if isKnown && time.Until(deadlineDate) < deadlineRiskWindow {
+		log.Printf("Warning: channel %s has backlog of outdated messages, the oldest of them can't be bulk deleted after %s",
+			channelProperties.ChannelID, deadlineDate.Format(time.DateTime))
+	}
+}
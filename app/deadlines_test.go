@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+// Order is the same as of due channels in storage
+func TestSortChannelsByDeadline(t *testing.T) {
+	channelsProperties := []*cpstorage.ChannelPropertiesEntity{
+		{ChannelID: "unknown"},
+		{ChannelID: "late", DeadlineDateUnix: 900},
+		{ChannelID: "early-second", DeadlineDateUnix: 500, NextRemoveDateUnix: 20},
+		{ChannelID: "early-first", DeadlineDateUnix: 500, NextRemoveDateUnix: 10},
+	}
+	sortChannelsByDeadline(channelsProperties)
+
+	var channelIDs []string
+	for _, channelProperties := range channelsProperties {
+		channelIDs = append(channelIDs, channelProperties.ChannelID)
+	}
+	if fmt.Sprint(channelIDs) != "[early-first early-second late unknown]" {
+		t.Errorf("Sorted channels = %v, want [early-first early-second late unknown]", channelIDs)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+// Human-friendly durations in command options: "90m", "3d12h", "1w". A plain number is hours
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cfgloader"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/i18n"
+)
+
+const maxAutocompleteChoices = 25 // Discord shows at most 25 autocomplete choices
+
+var (
+	durationPartRegexp = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*([wdhm])`)
+
+	// Hours in duration units
+	durationUnitsHours = map[string]float64{
+		"w": 7 * 24,
+		"d": 24,
+		"h": 1,
+		"m": 1.0 / 60,
+	}
+
+	// Suggested durations when nothing is typed yet
+	presetDurations = []string{"10m", "30m", "1h", "6h", "12h", "1d", "3d", "1w", "2w", "4w"}
+)
+
+// Parse duration string to hours. Duration must be finite and not negative
+func parseDurationHours(duration string) (hours float64, err error) {
+	duration = strings.ToLower(strings.TrimSpace(duration))
+	if duration == "" {
+		return 0, fmt.Errorf("duration is empty")
+	}
+
+	// Plain number is hours, as it was before units were supported
+	if plainHours, err := strconv.ParseFloat(duration, 64); err == nil {
+		hours = plainHours
+	} else {
+		// All the string must consist of number-unit parts
+		rest := durationPartRegexp.ReplaceAllString(duration, "")
+		if strings.TrimSpace(rest) != "" {
+			return 0, fmt.Errorf("invalid duration %q", duration)
+		}
+
+		for _, part := range durationPartRegexp.FindAllStringSubmatch(duration, -1) {
+			value, err := strconv.ParseFloat(part[1], 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", duration)
+			}
+			hours += value * durationUnitsHours[part[2]]
+		}
+	}
+
+	// ParseFloat accepts "NaN" and "Inf", too long numbers are parsed as Inf
+	if math.IsNaN(hours) || math.IsInf(hours, 0) || hours < 0 {
+		return 0, fmt.Errorf("invalid duration %q", duration)
+	}
+
+	return hours, nil
+}
+
+// Create duration option with autocomplete
+func newDurationOption(name string, isRequired bool) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         name,
+		Required:     isRequired,
+		Autocomplete: true,
+	}
+}
+
+// Get limits (hours) of duration options of the command
+func getDurationLimits(commandName string) (minHours float64, maxHours float64) {
+	switch commandName {
+	case "pause-timeout", "purge-now":
+		return minimalDurationHours, maximalDurationHours
+	default:
+		return getTimeoutLimits(currentConfig())
+	}
+}
+
+// Get limits (hours) of channel and user timeouts from config
+func getTimeoutLimits(config *cfgloader.Config) (minHours float64, maxHours float64) {
+	return config.MinimaOutdatelHoursValue, config.MaximumOutdateHoursValue
+}
+
+// Get duration option value in hours and check its limits.
+// Returns message for user if value is invalid
+func getDurationOption(interaction *discordgo.InteractionCreate, name string) (hours float64, isSet bool, invalidMessage string) {
+	option, ok := getCommandOptions(interaction)[name]
+	if !ok {
+		return 0, false, ""
+	}
+
+	hours, err := parseDurationHours(option.StringValue())
+	if err != nil {
+		return 0, true, i18n.T(getInteractionLocale(interaction), "duration.invalid", name, option.StringValue())
+	}
+
+	minHours, maxHours := getDurationLimits(interaction.ApplicationCommandData().Name)
+	if hours < minHours || hours > maxHours {
+		return 0, true, i18n.T(getInteractionLocale(interaction), "duration.limits", name, сonvertFloatHoursToTimeString(minHours), сonvertFloatHoursToTimeString(maxHours))
+	}
+
+	return hours, true, ""
+}
+
+// Triggered while user types duration option. Suggests durations within the limits of the command
+func DurationAutocompleteHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	commandData := interaction.ApplicationCommandData()
+	minHours, maxHours := getDurationLimits(commandData.Name)
+
+	input := ""
+	for _, option := range commandData.Options {
+		if option.Focused {
+			input = strings.TrimSpace(option.StringValue())
+		}
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, duration := range suggestDurations(input) {
+		hours, err := parseDurationHours(duration)
+		if err != nil || hours < minHours || hours > maxHours {
+			continue
+		}
+
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  сonvertFloatHoursToTimeString(hours),
+			Value: duration,
+		})
+		if len(choices) == maxAutocompleteChoices {
+			break
+		}
+	}
+
+	err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to respond to autocomplete: %v", err)
+	}
+}
+
+// Get durations for typed input: presets, the input itself or the typed number with each unit
+func suggestDurations(input string) (durations []string) {
+	if input == "" {
+		return presetDurations
+	}
+
+	if _, err := strconv.ParseFloat(input, 64); err == nil {
+		return []string{input + "m", input + "h", input + "d", input + "w"}
+	}
+
+	if _, err := parseDurationHours(input); err == nil {
+		return []string{input}
+	}
+
+	return nil
+}
+
+// Split hours to weeks, days, hours and minutes
+func splitDurationHours(hours float64) (weeks int, days int, wholeHours int, minutes int) {
+	totalMinutes := int(math.Round(hours * 60))
+
+	weeks = totalMinutes / (7 * 24 * 60)
+	totalMinutes %= 7 * 24 * 60
+	days = totalMinutes / (24 * 60)
+	totalMinutes %= 24 * 60
+	wholeHours = totalMinutes / 60
+	minutes = totalMinutes % 60
+
+	return
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseDurationHours(t *testing.T) {
+	tests := []struct {
+		duration  string
+		hours     float64
+		isInvalid bool
+	}{
+		{duration: "2", hours: 2},
+		{duration: "1.5", hours: 1.5},
+		{duration: "90m", hours: 1.5},
+		{duration: "3d12h", hours: 84},
+		{duration: "1w", hours: 168},
+		{duration: " 1D 2H ", hours: 26},
+		{duration: "0", hours: 0},
+		{duration: "", isInvalid: true},
+		{duration: "abc", isInvalid: true},
+		{duration: "1x", isInvalid: true},
+		{duration: "1h junk", isInvalid: true},
+		{duration: "-1", isInvalid: true},
+		{duration: "NaN", isInvalid: true},
+		{duration: "nan", isInvalid: true},
+		{duration: "Inf", isInvalid: true},
+		{duration: "-inf", isInvalid: true},
+		{duration: "+Infinity", isInvalid: true},
+		{duration: "1e309", isInvalid: true},
+		{duration: strings.Repeat("9", 400) + "w", isInvalid: true},
+	}
+
+	for _, test := range tests {
+		hours, err := parseDurationHours(test.duration)
+		if test.isInvalid {
+			if err == nil {
+				t.Errorf("parseDurationHours(%q) = %v, want error", test.duration, hours)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseDurationHours(%q) returned error: %v", test.duration, err)
+		} else if math.Abs(hours-test.hours) > 1e-9 {
+			t.Errorf("parseDurationHours(%q) = %v, want %v", test.duration, hours, test.hours)
+		}
+	}
+}
+
+func TestDurationLimitsAreFinite(t *testing.T) {
+	for _, commandName := range []string{"pause-timeout", "purge-now"} {
+		minHours, maxHours := getDurationLimits(commandName)
+		if minHours <= 0 || maxHours < minHours || math.IsInf(maxHours, 0) {
+			t.Errorf("getDurationLimits(%q) = %v, %v, want finite limits", commandName, minHours, maxHours)
+		}
+
+		// Huge number is finite, but it must not pass the limits
+		hours, err := parseDurationHours("1e300")
+		if err != nil {
+			t.Fatalf("parseDurationHours(\"1e300\") returned error: %v", err)
+		} else if hours <= maxHours {
+			t.Errorf("1e300 hours is within limits of %s", commandName)
+		}
+	}
+}
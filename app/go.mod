@@ -5,6 +5,7 @@ go 1.22.4
 require (
 	github.com/bwmarrin/discordgo v0.28.1
 	github.com/jmoiron/sqlx v1.4.0
+	github.com/lib/pq v1.10.9
 	gopkg.in/ini.v1 v1.67.0
 	modernc.org/sqlite v1.30.0
 )
@@ -0,0 +1,68 @@
+package main
+
+// Resolving guilds of channels
+
+import (
+	"log"
+
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+// Set guild ID for channels saved before guild ID was stored.
+// Unavailable channels are deleted, as the remover would do
+func BackfillChannelsGuilds() {
+	channelIDs, err := cpstorage.GetChannelsIdsWithoutGuild()
+	if err != nil {
+		log.Printf("Failed to get channels without guild: %v", err)
+		return
+	}
+	if len(channelIDs) == 0 {
+		return
+	}
+
+	log.Printf("Resolving guilds of %d channels...", len(channelIDs))
+
+	resolvedNumber := 0
+	for _, channelID := range channelIDs {
+		guildID, err := getChannelGuildID(channelID)
+		if err != nil && isErrorChannelUnavailable(err) {
+			log.Printf("Channel %s is unavaliable", channelID)
+			err = cpstorage.DeleteChannelProperties(channelID)
+			if err != nil {
+				log.Printf("Failed to delete channel %s: %v", channelID, err)
+			}
+			continue
+		} else if err != nil {
+			log.Printf("Failed to get channel %s: %v", channelID, err)
+			continue
+		}
+
+		// Direct messages channels have no guild
+		if guildID == "" {
+			continue
+		}
+
+		err = cpstorage.UpdateChannelGuild(channelID, guildID)
+		if err != nil {
+			log.Printf("Failed to update channel guild %s: %v", channelID, err)
+			continue
+		}
+		resolvedNumber++
+	}
+
+	log.Printf("Guilds of %d channels are resolved", resolvedNumber)
+}
+
+// Get guild ID of channel from state cache or from API
+func getChannelGuildID(channelID string) (guildID string, err error) {
+	channel, err := Session.State.Channel(channelID)
+	if err == nil {
+		return channel.GuildID, nil
+	}
+
+	channel, err = Session.Channel(channelID)
+	if err != nil {
+		return "", err
+	}
+	return channel.GuildID, nil
+}
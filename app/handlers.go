@@ -3,77 +3,152 @@ package main
 // Handlers
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
-	"math"
+	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/i18n"
 )
 
 var (
 	// Map of command handlers
 	commandHandlers = map[string]func(session *discordgo.Session, interaction *discordgo.InteractionCreate){
-		"set-timeout":    SetTimeoutCommandHandler,
-		"info-timeout":   InfoCommandHandler,
-		"remove-timeout": RemoveTimeoutCommandHandler,
+		"set-timeout":      SetTimeoutCommandHandler,
+		"info-timeout":     InfoCommandHandler,
+		"remove-timeout":   RemoveTimeoutCommandHandler,
+		"list-timeouts":    ListTimeoutsCommandHandler,
+		"pause-timeout":    PauseTimeoutCommandHandler,
+		"resume-timeout":   ResumeTimeoutCommandHandler,
+		"purge-now":        PurgeNowCommandHandler,
+		"my-timeout":       MyTimeoutCommandHandler,
+		"set-user-timeout": SetUserTimeoutCommandHandler,
+		"set-language":     SetLanguageCommandHandler,
+		"export-config":    ExportConfigCommandHandler,
+	}
+
+	// Map of message components (buttons) handlers. Key is the part of component custom ID before ":"
+	componentHandlers = map[string]func(session *discordgo.Session, interaction *discordgo.InteractionCreate){
+		"list-timeouts": ListTimeoutsPageHandler,
 	}
 )
 
 // Registers all handlers
 func RegisterHandlers() {
-	Session.AddHandler(CommandsHandler)
-	Session.AddHandler(ReadyHandler)
+	for _, session := range Sessions {
+		session.AddHandler(InteractionsHandler)
+		session.AddHandler(ReadyHandler)
+		session.AddHandler(GuildDeleteHandler)
+		session.AddHandler(MessageCreateHandler)
+		session.AddHandler(MessageDeleteHandler)
+		session.AddHandler(MessageDeleteBulkHandler)
+	}
 }
 
-// Triggered at startup
+// Triggered at startup of each shard
 func ReadyHandler(session *discordgo.Session, event *discordgo.Ready) {
-	log.Println("Bot has been successfully launched")
+	log.Printf("Bot has been successfully launched (shard %d of %d)", session.ShardID, session.ShardCount)
+
+	// Messages sent while the shard was disconnected are not received
+	messageEventsSinceDateUnix.Store(time.Now().Unix())
 }
 
-// Triggered when the user sends a command
-func CommandsHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
-	// Redirects to the handler of the corresponding command handler
-	if handler, ok := commandHandlers[interaction.ApplicationCommandData().Name]; ok {
-		handler(session, interaction)
+// Triggered when the bot leaves (is kicked from) the guild or the guild becomes unavailable
+func GuildDeleteHandler(session *discordgo.Session, event *discordgo.GuildDelete) {
+	// Unavailable guild is an outage on Discord side. Its channels must be kept
+	if event.Unavailable {
+		return
+	}
+
+	err := cpstorage.DeleteGuildChannelsProperties(event.ID)
+	if err != nil {
+		log.Printf("Failed to delete channels of removed guild %s: %v", event.ID, err)
+		return
+	}
+	log.Printf("Bot was removed from guild %s, its channels are deleted", event.ID)
+}
+
+// Triggered when the user sends a command or uses a message component
+func InteractionsHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	switch interaction.Type {
+	case discordgo.InteractionApplicationCommand:
+		// Redirects to the handler of the corresponding command handler
+		if handler, ok := commandHandlers[interaction.ApplicationCommandData().Name]; ok {
+			handler(session, interaction)
+		}
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		// Only duration options have autocomplete
+		DurationAutocompleteHandler(session, interaction)
+	case discordgo.InteractionMessageComponent:
+		// Redirects to the handler of the corresponding component
+		handlerName, _, _ := strings.Cut(interaction.MessageComponentData().CustomID, ":")
+		if handler, ok := componentHandlers[handlerName]; ok {
+			handler(session, interaction)
+		}
 	}
 }
 
 // Info timeout command handler
 func InfoCommandHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
-	channelID := interaction.ChannelID
+	channelID, isAllowed := resolveTargetChannel(session, interaction, viewTimeoutPermissions, 0)
+	if !isAllowed {
+		return
+	}
+	locale := getInteractionLocale(interaction)
 
 	// Get channelProperties
 	channelProperties, err := cpstorage.GetChannelProperties(channelID)
 
 	if err != nil {
 		log.Printf("Failed to get timeout %v", err)
-		responseToCommand("Failed to get timeout", session, interaction)
+		responseToCommand(i18n.T(locale, "error.get-timeout"), session, interaction)
 	} else if channelProperties == nil {
-		responseToCommand("Messages are not deleted in this channel", session, interaction)
+		responseToCommand(i18n.T(locale, "timeout.not-set", channelID), session, interaction)
 	} else {
-		responseMessage := fmt.Sprintf("All messages sent more than %s ago will be deleted", сonvertFloatHoursToTimeString(channelProperties.Timeout))
-		responseToCommand(responseMessage, session, interaction)
+		responseMessage := i18n.T(locale, "timeout.info", channelID, сonvertFloatHoursToTimeString(channelProperties.Timeout))
+		if channelProperties.IsPrecise {
+			responseMessage += "\n" + i18n.T(locale, "timeout.precise")
+		}
+		if channelProperties.IsArchiveThreads {
+			responseMessage += "\n" + i18n.T(locale, "timeout.archive-threads")
+		}
+		if channelProperties.IsPaused(time.Now().Unix()) {
+			responseMessage += "\n" + formatPauseState(locale, channelProperties.PausedUntilDateUnix)
+		}
 
-		err := cpstorage.UpdateChannelLastActivityDate(channelID, time.Now().Unix())
+		userTimeout, err := cpstorage.GetUserTimeout(channelID, getInteractionUserID(interaction))
 		if err != nil {
-			log.Printf("Failed to update channel last activity %v: ", err)
+			log.Printf("Failed to get user timeout: %v", err)
+		} else if userTimeout != nil {
+			// Own timeout is not longer than the channel timeout
+			ownTimeout := newChannelLifetimes(channelProperties, []*cpstorage.UserTimeoutEntity{userTimeout}).userTimeout(userTimeout.UserID)
+			responseMessage += "\n" + i18n.T(locale, "timeout.info-own", сonvertFloatHoursToTimeString(ownTimeout))
 		}
+		responseToCommand(responseMessage, session, interaction)
 	}
 }
 
 // Remove timeout command handler
 func RemoveTimeoutCommandHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
-	channelID := interaction.ChannelID
+	channelID, isAllowed := resolveTargetChannel(session, interaction, manageTimeoutPermissions, 0)
+	if !isAllowed {
+		return
+	}
 
-	responseMessage := "Deleting messages in the channel has been stopped"
+	locale := getInteractionLocale(interaction)
+	responseMessage := i18n.T(locale, "timeout.removed", channelID)
 
 	// Remove timeout
 	err := cpstorage.DeleteChannelProperties(channelID)
 	if err != nil {
-		responseMessage = "Failed to stop deletion"
+		responseMessage = i18n.T(locale, "error.stop-deletion")
 		log.Printf("Failed to stop deletion: %v", err)
+	} else {
+		writeInteractionAuditEntry(interaction, channelID, "")
 	}
 
 	responseToCommand(responseMessage, session, interaction)
@@ -81,28 +156,236 @@ func RemoveTimeoutCommandHandler(session *discordgo.Session, interaction *discor
 
 // Set timeout command handler
 func SetTimeoutCommandHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
-	hours := interaction.ApplicationCommandData().Options[0].FloatValue()
-	channelID := interaction.ChannelID
+	channelID, isAllowed := resolveTargetChannel(session, interaction, manageTimeoutPermissions, botRemovePermissions)
+	if !isAllowed {
+		return
+	}
+
+	hours, _, invalidMessage := getDurationOption(interaction, "duration")
+	if invalidMessage != "" {
+		responseToCommand(invalidMessage, session, interaction)
+		return
+	}
 
-	responseMessage := fmt.Sprintf("All messages sent more than %s ago will be deleted", сonvertFloatHoursToTimeString(hours))
+	locale := getInteractionLocale(interaction)
+	responseMessage := i18n.T(locale, "timeout.info", channelID, сonvertFloatHoursToTimeString(hours))
+
+	// Pause and channel modes must survive timeout change
+	var pausedUntilDateUnix int64
+	var isPrecise, wasPrecise, isArchiveThreads bool
+	oldChannelProperties, err := cpstorage.GetChannelProperties(channelID)
+	if err != nil {
+		log.Printf("Failed to get timeout: %v", err)
+		responseToCommand(i18n.T(locale, "error.save-timeout"), session, interaction)
+		return
+	} else if oldChannelProperties != nil {
+		pausedUntilDateUnix = oldChannelProperties.PausedUntilDateUnix
+		wasPrecise = oldChannelProperties.IsPrecise
+		isArchiveThreads = oldChannelProperties.IsArchiveThreads
+	}
+	isPrecise = wasPrecise
+	commandOptions := getCommandOptions(interaction)
+	if option, ok := commandOptions["precise"]; ok {
+		isPrecise = option.BoolValue()
+	}
+	if option, ok := commandOptions["archive-threads"]; ok {
+		isArchiveThreads = option.BoolValue()
+	}
+	if isPrecise {
+		responseMessage += "\n" + i18n.T(locale, "timeout.precise")
+	}
+	if isArchiveThreads {
+		responseMessage += "\n" + i18n.T(locale, "timeout.archive-threads")
+	}
 
 	channelProperties := cpstorage.ChannelPropertiesEntity{
 		ChannelID:            channelID,
 		Timeout:              hours,
 		LastActivityDateUnix: time.Now().Unix(),
 		NextRemoveDateUnix:   0, // Channel must be checked now
+		GuildID:              interaction.GuildID,
+		PausedUntilDateUnix:  pausedUntilDateUnix,
+		IsPrecise:            isPrecise,
+		IsArchiveThreads:     isArchiveThreads,
 	}
 
 	// Save channel properties
-	err := cpstorage.WriteChannelProperties(&channelProperties)
+	err = cpstorage.WriteChannelProperties(&channelProperties)
 	if err != nil {
-		responseMessage = "Failed to save timeout"
+		responseMessage = i18n.T(locale, "error.save-timeout")
 		log.Printf("Failed to save timeout: %v", err)
+	} else {
+		writeInteractionAuditEntry(interaction, channelID, "timeout "+сonvertFloatHoursToTimeString(hours))
+		scheduleChangedChannel(channelID, pausedUntilDateUnix)
+
+		// Messages sent before precise mode was turned on get their timers too
+		if isPrecise && !wasPrecise {
+			go reconcileChannelExpiringMessages(&channelProperties)
+		}
 	}
 
 	responseToCommand(responseMessage, session, interaction)
 }
 
+// Pause timeout command handler
+func PauseTimeoutCommandHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	channelID, isAllowed := resolveTargetChannel(session, interaction, manageTimeoutPermissions, 0)
+	if !isAllowed {
+		return
+	}
+	locale := getInteractionLocale(interaction)
+
+	channelProperties, err := cpstorage.GetChannelProperties(channelID)
+	if err != nil {
+		log.Printf("Failed to get timeout: %v", err)
+		responseToCommand(i18n.T(locale, "error.pause"), session, interaction)
+		return
+	} else if channelProperties == nil {
+		responseToCommand(i18n.T(locale, "timeout.not-set", channelID), session, interaction)
+		return
+	}
+
+	// Without duration pause lasts until manual resume
+	pausedUntilDateUnix := cpstorage.PausedIndefinitely
+	hours, isSet, invalidMessage := getDurationOption(interaction, "duration")
+	if invalidMessage != "" {
+		responseToCommand(invalidMessage, session, interaction)
+		return
+	} else if isSet {
+		pausedUntilDateUnix = time.Now().Add(time.Duration(hours * float64(time.Hour))).Unix()
+	}
+
+	err = cpstorage.PauseChannel(channelID, pausedUntilDateUnix)
+	if err != nil {
+		log.Printf("Failed to pause deletion: %v", err)
+		responseToCommand(i18n.T(locale, "error.pause"), session, interaction)
+		return
+	}
+	writeInteractionAuditEntry(interaction, channelID, formatAuditPause(pausedUntilDateUnix))
+	scheduleChangedChannel(channelID, pausedUntilDateUnix)
+
+	responseToCommand(formatPauseState(locale, pausedUntilDateUnix), session, interaction)
+}
+
+// Resume timeout command handler
+func ResumeTimeoutCommandHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	channelID, isAllowed := resolveTargetChannel(session, interaction, manageTimeoutPermissions, 0)
+	if !isAllowed {
+		return
+	}
+	locale := getInteractionLocale(interaction)
+
+	channelProperties, err := cpstorage.GetChannelProperties(channelID)
+	if err != nil {
+		log.Printf("Failed to get timeout: %v", err)
+		responseToCommand(i18n.T(locale, "error.resume"), session, interaction)
+		return
+	} else if channelProperties == nil {
+		responseToCommand(i18n.T(locale, "timeout.not-set", channelID), session, interaction)
+		return
+	} else if !channelProperties.IsPaused(time.Now().Unix()) {
+		responseToCommand(i18n.T(locale, "pause.not-paused", channelID), session, interaction)
+		return
+	}
+
+	err = cpstorage.ResumeChannel(channelID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to resume deletion: %v", err)
+		responseToCommand(i18n.T(locale, "error.resume"), session, interaction)
+		return
+	}
+	writeInteractionAuditEntry(interaction, channelID, "")
+	scheduleChangedChannel(channelID, 0)
+
+	responseToCommand(i18n.T(locale, "pause.resumed", channelID), session, interaction)
+}
+
+// Format pause end for user
+func formatPauseState(locale string, pausedUntilDateUnix int64) string {
+	if pausedUntilDateUnix == cpstorage.PausedIndefinitely {
+		return i18n.T(locale, "pause.until-resume")
+	}
+	return i18n.T(locale, "pause.until", pausedUntilDateUnix)
+}
+
+// Set language command handler. Sets locale of replies in the guild
+func SetLanguageCommandHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	if interaction.GuildID == "" {
+		responseToCommand(i18n.T(getInteractionLocale(interaction), "list.guild-only"), session, interaction)
+		return
+	}
+
+	// Without language each user gets replies in own language
+	locale := ""
+	if option, ok := getCommandOptions(interaction)["language"]; ok {
+		locale = option.StringValue()
+	}
+
+	err := cpstorage.SetGuildLocale(interaction.GuildID, locale)
+	if err != nil {
+		log.Printf("Failed to save guild locale: %v", err)
+		responseToCommand(i18n.T(getInteractionLocale(interaction), "error.save-language"), session, interaction)
+		return
+	}
+	writeInteractionAuditEntry(interaction, "", "language "+locale)
+
+	if locale == "" {
+		responseToCommand(i18n.T(getInteractionLocale(interaction), "language.auto"), session, interaction)
+		return
+	}
+	responseToCommand(i18n.T(locale, "language.set"), session, interaction)
+}
+
+// Export config command handler. Responds with configuration of the guild as JSON file
+func ExportConfigCommandHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	locale := getInteractionLocale(interaction)
+	if interaction.GuildID == "" {
+		responseToCommand(i18n.T(locale, "list.guild-only"), session, interaction)
+		return
+	}
+
+	document, err := cpstorage.Export(interaction.GuildID)
+	if err != nil {
+		log.Printf("Failed to export guild %s: %v", interaction.GuildID, err)
+		responseToCommand(i18n.T(locale, "error.export"), session, interaction)
+		return
+	}
+
+	documentJSON, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		log.Printf("Failed to marshal export of guild %s: %v", interaction.GuildID, err)
+		responseToCommand(i18n.T(locale, "error.export"), session, interaction)
+		return
+	}
+
+	err = session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: i18n.T(locale, "export.done", len(document.Channels)),
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Files: []*discordgo.File{
+				{
+					Name:        fmt.Sprintf("outdate-delete-config-%s.json", interaction.GuildID),
+					ContentType: "application/json",
+					Reader:      bytes.NewReader(documentJSON),
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to respond with export of guild %s: %v", interaction.GuildID, err)
+	}
+}
+
+// Get options of the command by name
+func getCommandOptions(interaction *discordgo.InteractionCreate) (options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	options = map[string]*discordgo.ApplicationCommandInteractionDataOption{}
+	for _, option := range interaction.ApplicationCommandData().Options {
+		options[option.Name] = option
+	}
+	return options
+}
+
 // Universal way to responsd to command
 func responseToCommand(message string, session *discordgo.Session, interaction *discordgo.InteractionCreate) (err error) {
 	err = session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
@@ -115,9 +398,31 @@ func responseToCommand(message string, session *discordgo.Session, interaction *
 	return
 }
 
-// Format hours (float) to "Xh Ym" form
+// Replace the text of command response. Used with deferred responses
+func editCommandResponse(message string, session *discordgo.Session, interaction *discordgo.InteractionCreate) (err error) {
+	_, err = session.InteractionResponseEdit(interaction.Interaction, &discordgo.WebhookEdit{
+		Content: &message,
+	})
+	return
+}
+
+// Format hours (float) to "Xw Yd Zh Tm" form. Zero parts are skipped
 func сonvertFloatHoursToTimeString(hours float64) string {
-	h := int(math.Floor(hours))
-	m := int(math.Round((hours - float64(h)) * 60))
-	return fmt.Sprintf("%dh %dm", h, m)
+	weeks, days, wholeHours, minutes := splitDurationHours(hours)
+
+	var parts []string
+	if weeks > 0 {
+		parts = append(parts, fmt.Sprintf("%dw", weeks))
+	}
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%dd", days))
+	}
+	if wholeHours > 0 {
+		parts = append(parts, fmt.Sprintf("%dh", wholeHours))
+	}
+	if minutes > 0 || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("%dm", minutes))
+	}
+
+	return strings.Join(parts, " ")
 }
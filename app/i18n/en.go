@@ -0,0 +1,121 @@
+package i18n
+
+// English catalogue. Default one, all keys must be here
+
+var english = map[string]string{
+	// Commands
+	"command.info-timeout.name":                              "info-timeout",
+	"command.info-timeout.description":                       "Shows timeout set in the channel",
+	"command.remove-timeout.name":                            "remove-timeout",
+	"command.remove-timeout.description":                     "Stop removing message int channel",
+	"command.set-timeout.name":                               "set-timeout",
+	"command.set-timeout.description":                        "Bot deletes messages older than specified time in the channel",
+	"command.set-timeout.option.duration.name":               "duration",
+	"command.set-timeout.option.duration.description":        "message lifetime, e.g. 90m, 3d12h, 1w (from %s to %s)",
+	"command.set-timeout.option.precise.name":                "precise",
+	"command.set-timeout.option.precise.description":         "delete every message exactly when it becomes outdated (for short timeouts)",
+	"command.set-timeout.option.archive-threads.name":        "archive-threads",
+	"command.set-timeout.option.archive-threads.description": "archive threads with recent messages instead of deleting them with their start messages",
+	"command.pause-timeout.name":                             "pause-timeout",
+	"command.pause-timeout.description":                      "Temporarily stop deleting messages in the channel, keeping the timeout",
+	"command.pause-timeout.option.duration.name":             "duration",
+	"command.pause-timeout.option.duration.description":      "pause duration, e.g. 90m, 3d12h, 1w (until resume if not specified)",
+	"command.resume-timeout.name":                            "resume-timeout",
+	"command.resume-timeout.description":                     "Resume deleting messages in the channel after pause",
+	"command.purge-now.name":                                 "purge-now",
+	"command.purge-now.description":                          "Delete outdated messages in the channel right now",
+	"command.purge-now.option.older-than.name":               "older-than",
+	"command.purge-now.option.older-than.description":        "delete messages older than specified time, e.g. 90m, 1d (channel timeout by default)",
+	"command.purge-now.option.limit.name":                    "limit",
+	"command.purge-now.option.limit.description":             "maximum number of messages to delete",
+	"command.purge-now.option.user.name":                     "user",
+	"command.purge-now.option.user.description":              "delete only messages of this user",
+	"command.my-timeout.name":                                "my-timeout",
+	"command.my-timeout.description":                         "Delete your own messages in the channel earlier than the channel timeout",
+	"command.my-timeout.option.duration.name":                "duration",
+	"command.my-timeout.option.duration.description":         "lifetime of your messages, e.g. 90m, 1d (channel timeout if not specified)",
+	"command.set-user-timeout.name":                          "set-user-timeout",
+	"command.set-user-timeout.description":                   "Set lifetime for messages of the user in the channel",
+	"command.set-user-timeout.option.user.name":              "user",
+	"command.set-user-timeout.option.user.description":       "user whose messages lifetime is set",
+	"command.set-user-timeout.option.duration.name":          "duration",
+	"command.set-user-timeout.option.duration.description":   "lifetime of user messages, e.g. 90m, 1d (channel timeout if not specified)",
+	"command.list-timeouts.name":                             "list-timeouts",
+	"command.list-timeouts.description":                      "Shows all channels of the server where messages are deleted",
+	"command.export-config.name":                             "export-config",
+	"command.export-config.description":                      "Export timeouts and settings of the server as a file",
+	"command.set-language.name":                              "set-language",
+	"command.set-language.description":                       "Set the language of bot replies in the server",
+	"command.set-language.option.language.name":              "language",
+	"command.set-language.option.language.description":       "language of replies (language of each user if not specified)",
+	"option.channel.name":                                    "channel",
+	"option.channel.description":                             "Channel to apply the command to (current channel by default)",
+
+	// Errors
+	"error.get-timeout":       "Failed to get timeout",
+	"error.save-timeout":      "Failed to save timeout",
+	"error.stop-deletion":     "Failed to stop deletion",
+	"error.pause":             "Failed to pause deletion",
+	"error.resume":            "Failed to resume deletion",
+	"error.get-channels":      "Failed to get channels",
+	"error.check-permissions": "Failed to check permissions",
+	"error.save-language":     "Failed to save language",
+	"error.export":            "Failed to export configuration",
+
+	// Timeouts
+	"timeout.not-set":         "Messages are not deleted in <#%s>",
+	"timeout.not-set-here":    "Messages are not deleted in this channel",
+	"timeout.info":            "All messages in <#%s> sent more than %s ago will be deleted",
+	"timeout.precise":         "Every message is deleted exactly on time",
+	"timeout.archive-threads": "Threads with recent messages are archived instead of deleted",
+	"timeout.info-own":        "Your messages sent more than %s ago will be deleted",
+	"timeout.removed":         "Deleting messages in <#%s> has been stopped",
+
+	// Pause
+	"pause.until-resume": "Deleting is paused until /resume-timeout",
+	"pause.until":        "Deleting is paused until <t:%d:f>",
+	"pause.not-paused":   "Deleting messages in <#%s> is not paused",
+	"pause.resumed":      "Deleting messages in <#%s> has been resumed",
+
+	// List of timeouts
+	"list.guild-only":    "This command is available only in servers",
+	"list.empty":         "Messages are not deleted in any channel of this server",
+	"list.title":         "Channels where messages are deleted",
+	"list.footer":        "Page %d/%d · %d channels",
+	"list.previous":      "Previous",
+	"list.next":          "Next",
+	"list.purge-now":     "now",
+	"list.paused":        "paused",
+	"list.paused-until":  "paused until <t:%d:R>",
+	"list.line":          "<#%s> — lifetime **%s**, next purge %s, last activity <t:%d:R>",
+	"list.user-timeouts": ", %d users with own lifetime",
+
+	// Permissions
+	"permissions.user": "You don't have enough permissions in <#%s>",
+	"permissions.bot":  "Bot needs View Channel, Read Message History and Manage Messages permissions in <#%s>",
+
+	// Purge
+	"purge.no-timeout": "Messages are not deleted in <#%s>, specify older-than",
+	"purge.running":    "Messages in <#%s> are already being deleted",
+	"purge.progress":   "Deleting... %d messages deleted and %d threads queued for cleanup so far",
+	"purge.done":       "Done. %d messages deleted and %d threads queued for cleanup in <#%s>",
+	"purge.failed":     "Deleting failed. %d messages deleted and %d threads queued for cleanup in <#%s> before the error",
+
+	// User timeouts
+	"user-timeout.own-reset":          "Your messages will be deleted by the channel timeout (%s)",
+	"user-timeout.own-too-long":       "Your timeout must be shorter than the channel timeout (%s)",
+	"user-timeout.no-channel-timeout": "Messages are not deleted in <#%s>, set the channel timeout first",
+	"user-timeout.reset":              "Messages of <@%s> in <#%s> will be deleted by the channel timeout",
+	"user-timeout.set":                "Messages of <@%s> in <#%s> sent more than %s ago will be deleted",
+
+	// Durations
+	"duration.invalid": "Can't read %s %q. Use for example 90m, 3d12h or 1w",
+	"duration.limits":  "%s must be from %s to %s",
+
+	// Language
+	"language.set":  "Replies in this server will be in English",
+	"language.auto": "Replies in this server will be in the language of each user",
+
+	// Export
+	"export.done": "Configuration of %d channels of this server. It can be imported with the import subcommand of the bot",
+}
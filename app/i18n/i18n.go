@@ -0,0 +1,142 @@
+// Message catalogues for replies and command definitions
+
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const DefaultLocale = "en" // Locale used if user locale has no catalogue
+
+var (
+	// Message catalogues: locale -> message key -> message
+	catalogues = map[string]map[string]string{
+		"en": english,
+		"ru": russian,
+	}
+
+	// Discord locales of each catalogue locale
+	discordLocales = map[string][]string{
+		"en": {"en-US", "en-GB"},
+		"ru": {"ru"},
+	}
+
+	formatVerbRegexp = regexp.MustCompile(`%(\[\d+\])?[a-zA-Z]`)
+)
+
+// Get message by key in the locale, formatted with args.
+// Falls back to default locale if the locale has no catalogue
+func T(locale string, key string, args ...any) string {
+	catalogue, ok := catalogues[MatchLocale(locale)]
+	if !ok {
+		catalogue = catalogues[DefaultLocale]
+	}
+
+	message, ok := catalogue[key]
+	if !ok {
+		message, ok = catalogues[DefaultLocale][key]
+		if !ok {
+			return key
+		}
+	}
+
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// Check if message key exists in default catalogue
+func HasKey(key string) bool {
+	_, ok := catalogues[DefaultLocale][key]
+	return ok
+}
+
+// Get catalogue locale for Discord locale ("en-US" -> "en").
+// Returns default locale if there is no suitable catalogue
+func MatchLocale(locale string) string {
+	if _, ok := catalogues[locale]; ok {
+		return locale
+	}
+
+	language, _, _ := strings.Cut(locale, "-")
+	if _, ok := catalogues[language]; ok {
+		return language
+	}
+
+	return DefaultLocale
+}
+
+// Get catalogue locales sorted by name
+func Locales() (locales []string) {
+	for locale := range catalogues {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Get message translated to all Discord locales except locales of the default catalogue.
+// Used for localizations of command names and descriptions
+func Translations(key string, args ...any) map[string]string {
+	translations := map[string]string{}
+	for locale, catalogue := range catalogues {
+		if locale == DefaultLocale {
+			continue
+		}
+		if _, ok := catalogue[key]; !ok {
+			continue
+		}
+		for _, discordLocale := range discordLocales[locale] {
+			translations[discordLocale] = T(locale, key, args...)
+		}
+	}
+	return translations
+}
+
+// Check that every key exists in every catalogue with the same format verbs
+func CheckCatalogues() error {
+	var errs []error
+
+	defaultCatalogue := catalogues[DefaultLocale]
+	for _, locale := range Locales() {
+		catalogue := catalogues[locale]
+
+		for key, defaultMessage := range defaultCatalogue {
+			message, ok := catalogue[key]
+			if !ok {
+				errs = append(errs, fmt.Errorf("locale %s: missing key %s", locale, key))
+				continue
+			}
+			if !isSameFormatVerbs(defaultMessage, message) {
+				errs = append(errs, fmt.Errorf("locale %s: key %s has other format verbs than %s", locale, key, DefaultLocale))
+			}
+		}
+
+		for key := range catalogue {
+			if _, ok := defaultCatalogue[key]; !ok {
+				errs = append(errs, fmt.Errorf("locale %s: unknown key %s", locale, key))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Check if messages have the same format verbs, ignoring their order and explicit argument indexes
+func isSameFormatVerbs(message1 string, message2 string) bool {
+	return strings.Join(getFormatVerbs(message1), " ") == strings.Join(getFormatVerbs(message2), " ")
+}
+
+// Get sorted format verbs of the message without argument indexes ("%[2]s" -> "s")
+func getFormatVerbs(message string) (verbs []string) {
+	for _, verb := range formatVerbRegexp.FindAllString(message, -1) {
+		verbs = append(verbs, verb[len(verb)-1:])
+	}
+	sort.Strings(verbs)
+	return verbs
+}
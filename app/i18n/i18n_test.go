@@ -0,0 +1,76 @@
+package i18n
+
+import (
+	"sort"
+	"testing"
+)
+
+// Every key of any catalogue must be in every catalogue
+func TestCataloguesHaveAllKeys(t *testing.T) {
+	allKeys := map[string]bool{}
+	for _, catalogue := range catalogues {
+		for key := range catalogue {
+			allKeys[key] = true
+		}
+	}
+
+	for _, locale := range Locales() {
+		var missingKeys []string
+		for key := range allKeys {
+			if _, ok := catalogues[locale][key]; !ok {
+				missingKeys = append(missingKeys, key)
+			}
+		}
+		sort.Strings(missingKeys)
+		for _, key := range missingKeys {
+			t.Errorf("Locale %s: missing key %s", locale, key)
+		}
+	}
+}
+
+func TestCheckCatalogues(t *testing.T) {
+	err := CheckCatalogues()
+	if err != nil {
+		t.Fatalf("CheckCatalogues returned error: %v", err)
+	}
+}
+
+func TestIsSameFormatVerbs(t *testing.T) {
+	tests := []struct {
+		message1, message2 string
+		isSame             bool
+	}{
+		{"from %s to %s", "от %s до %s", true},
+		{"%s: %d", "%[2]d у %[1]s", true},
+		{"100%% done", "готово на 100%%", true},
+		{"%s", "%d", false},
+		{"%s and %s", "%s", false},
+	}
+
+	for _, test := range tests {
+		if isSame := isSameFormatVerbs(test.message1, test.message2); isSame != test.isSame {
+			t.Errorf("isSameFormatVerbs(%q, %q) = %t, want %t", test.message1, test.message2, isSame, test.isSame)
+		}
+	}
+}
+
+// Missing translation falls back to default catalogue, unknown key is returned as is
+func TestTFallback(t *testing.T) {
+	// Test catalogues replace the real ones, so the real ones are not changed
+	realCatalogues := catalogues
+	t.Cleanup(func() { catalogues = realCatalogues })
+	catalogues = map[string]map[string]string{
+		"en": {"test.only-english": "only %s"},
+		"ru": {},
+	}
+
+	if message := T("ru", "test.only-english", "english"); message != "only english" {
+		t.Errorf("T(ru) of key without translation = %q, want default message", message)
+	}
+	if message := T("ru", "test.unknown"); message != "test.unknown" {
+		t.Errorf("T of unknown key = %q, want the key", message)
+	}
+	if locale := MatchLocale("en-GB"); locale != "en" {
+		t.Errorf("MatchLocale(en-GB) = %q, want en", locale)
+	}
+}
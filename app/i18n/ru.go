@@ -0,0 +1,121 @@
+package i18n
+
+// Russian catalogue
+
+var russian = map[string]string{
+	// Commands
+	"command.info-timeout.name":                              "инфо-таймаут",
+	"command.info-timeout.description":                       "Показывает таймаут, установленный в канале",
+	"command.remove-timeout.name":                            "удалить-таймаут",
+	"command.remove-timeout.description":                     "Прекратить удаление сообщений в канале",
+	"command.set-timeout.name":                               "установить-таймаут",
+	"command.set-timeout.description":                        "Бот удаляет сообщения в канале старше указанного времени",
+	"command.set-timeout.option.duration.name":               "длительность",
+	"command.set-timeout.option.duration.description":        "время жизни сообщений, например 90m, 3d12h, 1w (от %s до %s)",
+	"command.set-timeout.option.precise.name":                "точно",
+	"command.set-timeout.option.precise.description":         "удалять каждое сообщение точно в момент устаревания (для коротких таймаутов)",
+	"command.set-timeout.option.archive-threads.name":        "архивировать-ветки",
+	"command.set-timeout.option.archive-threads.description": "архивировать ветки с недавними сообщениями вместо удаления вместе с их первыми сообщениями",
+	"command.pause-timeout.name":                             "приостановить-таймаут",
+	"command.pause-timeout.description":                      "Временно остановить удаление сообщений в канале, сохранив таймаут",
+	"command.pause-timeout.option.duration.name":             "длительность",
+	"command.pause-timeout.option.duration.description":      "длительность паузы, например 90m, 3d12h, 1w (до возобновления, если не указана)",
+	"command.resume-timeout.name":                            "возобновить-таймаут",
+	"command.resume-timeout.description":                     "Возобновить удаление сообщений в канале после паузы",
+	"command.purge-now.name":                                 "очистить-сейчас",
+	"command.purge-now.description":                          "Удалить устаревшие сообщения в канале прямо сейчас",
+	"command.purge-now.option.older-than.name":               "старше",
+	"command.purge-now.option.older-than.description":        "удалить сообщения старше указанного времени, например 90m, 1d (по умолчанию таймаут канала)",
+	"command.purge-now.option.limit.name":                    "лимит",
+	"command.purge-now.option.limit.description":             "максимальное количество удаляемых сообщений",
+	"command.purge-now.option.user.name":                     "пользователь",
+	"command.purge-now.option.user.description":              "удалить только сообщения этого пользователя",
+	"command.my-timeout.name":                                "мой-таймаут",
+	"command.my-timeout.description":                         "Удалять ваши сообщения в канале раньше таймаута канала",
+	"command.my-timeout.option.duration.name":                "длительность",
+	"command.my-timeout.option.duration.description":         "время жизни ваших сообщений, например 90m, 1d (таймаут канала, если не указано)",
+	"command.set-user-timeout.name":                          "таймаут-пользователя",
+	"command.set-user-timeout.description":                   "Установить время жизни сообщений пользователя в канале",
+	"command.set-user-timeout.option.user.name":              "пользователь",
+	"command.set-user-timeout.option.user.description":       "пользователь, для сообщений которого задается время жизни",
+	"command.set-user-timeout.option.duration.name":          "длительность",
+	"command.set-user-timeout.option.duration.description":   "время жизни сообщений пользователя, например 90m, 1d (таймаут канала, если не указано)",
+	"command.list-timeouts.name":                             "список-таймаутов",
+	"command.list-timeouts.description":                      "Показывает все каналы сервера, в которых удаляются сообщения",
+	"command.export-config.name":                             "экспорт-настроек",
+	"command.export-config.description":                      "Экспортировать таймауты и настройки сервера в файл",
+	"command.set-language.name":                              "язык-бота",
+	"command.set-language.description":                       "Установить язык ответов бота на сервере",
+	"command.set-language.option.language.name":              "язык",
+	"command.set-language.option.language.description":       "язык ответов (язык каждого пользователя, если не указан)",
+	"option.channel.name":                                    "канал",
+	"option.channel.description":                             "Канал, к которому применяется команда (по умолчанию текущий)",
+
+	// Errors
+	"error.get-timeout":       "Не удалось получить таймаут",
+	"error.save-timeout":      "Не удалось сохранить таймаут",
+	"error.stop-deletion":     "Не удалось остановить удаление",
+	"error.pause":             "Не удалось приостановить удаление",
+	"error.resume":            "Не удалось возобновить удаление",
+	"error.get-channels":      "Не удалось получить каналы",
+	"error.check-permissions": "Не удалось проверить права",
+	"error.save-language":     "Не удалось сохранить язык",
+	"error.export":            "Не удалось экспортировать настройки",
+
+	// Timeouts
+	"timeout.not-set":         "Сообщения в <#%s> не удаляются",
+	"timeout.not-set-here":    "Сообщения в этом канале не удаляются",
+	"timeout.info":            "Все сообщения в <#%s>, отправленные более %s назад, будут удалены",
+	"timeout.precise":         "Каждое сообщение удаляется точно в срок",
+	"timeout.archive-threads": "Ветки с недавними сообщениями архивируются, а не удаляются",
+	"timeout.info-own":        "Ваши сообщения, отправленные более %s назад, будут удалены",
+	"timeout.removed":         "Удаление сообщений в <#%s> остановлено",
+
+	// Pause
+	"pause.until-resume": "Удаление приостановлено до /возобновить-таймаут",
+	"pause.until":        "Удаление приостановлено до <t:%d:f>",
+	"pause.not-paused":   "Удаление сообщений в <#%s> не приостановлено",
+	"pause.resumed":      "Удаление сообщений в <#%s> возобновлено",
+
+	// List of timeouts
+	"list.guild-only":    "Эта команда доступна только на серверах",
+	"list.empty":         "Ни в одном канале этого сервера сообщения не удаляются",
+	"list.title":         "Каналы, в которых удаляются сообщения",
+	"list.footer":        "Страница %d/%d · каналов: %d",
+	"list.previous":      "Назад",
+	"list.next":          "Вперед",
+	"list.purge-now":     "сейчас",
+	"list.paused":        "приостановлено",
+	"list.paused-until":  "приостановлено до <t:%d:R>",
+	"list.line":          "<#%s> — время жизни **%s**, следующая очистка %s, последняя активность <t:%d:R>",
+	"list.user-timeouts": ", пользователей со своим временем жизни: %d",
+
+	// Permissions
+	"permissions.user": "У вас недостаточно прав в <#%s>",
+	"permissions.bot":  "Боту нужны права «Просматривать канал», «Читать историю сообщений» и «Управлять сообщениями» в <#%s>",
+
+	// Purge
+	"purge.no-timeout": "Сообщения в <#%s> не удаляются, укажите «старше»",
+	"purge.running":    "Сообщения в <#%s> уже удаляются",
+	"purge.progress":   "Удаление... Удалено сообщений: %d, веток в очереди на очистку: %d",
+	"purge.done":       "Готово. Удалено сообщений: %d, веток в очереди на очистку: %d в <#%s>",
+	"purge.failed":     "Ошибка удаления. До ошибки удалено сообщений: %d, веток в очереди на очистку: %d в <#%s>",
+
+	// User timeouts
+	"user-timeout.own-reset":          "Ваши сообщения будут удаляться по таймауту канала (%s)",
+	"user-timeout.own-too-long":       "Ваш таймаут должен быть короче таймаута канала (%s)",
+	"user-timeout.no-channel-timeout": "Сообщения в <#%s> не удаляются, сначала установите таймаут канала",
+	"user-timeout.reset":              "Сообщения <@%s> в <#%s> будут удаляться по таймауту канала",
+	"user-timeout.set":                "Сообщения <@%s> в <#%s>, отправленные более %s назад, будут удалены",
+
+	// Durations
+	"duration.invalid": "Не удалось прочитать %s %q. Используйте, например, 90m, 3d12h или 1w",
+	"duration.limits":  "%s должно быть от %s до %s",
+
+	// Language
+	"language.set":  "Ответы на этом сервере будут на русском",
+	"language.auto": "Ответы на этом сервере будут на языке каждого пользователя",
+
+	// Export
+	"export.done": "Настройки %d каналов этого сервера. Их можно импортировать подкомандой import бота",
+}
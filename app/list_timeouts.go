@@ -0,0 +1,164 @@
+package main
+
+// List of all channels with timeout in the guild
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/i18n"
+)
+
+const listTimeoutsPageSize = 10 // Number of channels on one page of the list
+
+// List timeouts command handler. Shows the first page
+func ListTimeoutsCommandHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	locale := getInteractionLocale(interaction)
+	if interaction.GuildID == "" {
+		responseToCommand(i18n.T(locale, "list.guild-only"), session, interaction)
+		return
+	}
+
+	responseData, err := buildListTimeoutsPage(locale, interaction.GuildID, 0)
+	if err != nil {
+		log.Printf("Failed to get guild channels: %v", err)
+		responseToCommand(i18n.T(locale, "error.get-channels"), session, interaction)
+		return
+	}
+
+	responseData.Flags = discordgo.MessageFlagsEphemeral
+	err = session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: responseData,
+	})
+	if err != nil {
+		log.Printf("Failed to respond to list-timeouts: %v", err)
+	}
+}
+
+// Handler of the list navigation buttons. Button custom ID is "list-timeouts:<page>"
+func ListTimeoutsPageHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	_, pageStr, _ := strings.Cut(interaction.MessageComponentData().CustomID, ":")
+	locale := getInteractionLocale(interaction)
+	page, err := strconv.Atoi(pageStr)
+	if err != nil {
+		log.Printf("Invalid list-timeouts page %q: %v", pageStr, err)
+		responseToCommand(i18n.T(locale, "error.get-channels"), session, interaction)
+		return
+	}
+
+	responseData, err := buildListTimeoutsPage(locale, interaction.GuildID, page)
+	if err != nil {
+		log.Printf("Failed to get guild channels: %v", err)
+		responseToCommand(i18n.T(locale, "error.get-channels"), session, interaction)
+		return
+	}
+
+	err = session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: responseData,
+	})
+	if err != nil {
+		log.Printf("Failed to update list-timeouts page: %v", err)
+	}
+}
+
+// Build embed with page of guild channels and navigation buttons
+func buildListTimeoutsPage(locale string, guildID string, page int) (responseData *discordgo.InteractionResponseData, err error) {
+	channelsNumber, err := cpstorage.CountGuildChannelsProperties(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Page may be out of range if channels were deleted after the list was shown
+	pagesNumber := max(1, (channelsNumber+listTimeoutsPageSize-1)/listTimeoutsPageSize)
+	page = min(max(page, 0), pagesNumber-1)
+
+	channelsProperties, err := cpstorage.GetGuildChannelsPropertiesPage(guildID, page*listTimeoutsPageSize, listTimeoutsPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Users with own lifetime are exemptions from the channel lifetime
+	channelIDs := make([]string, len(channelsProperties))
+	for i, channelProperties := range channelsProperties {
+		channelIDs[i] = channelProperties.ChannelID
+	}
+	userTimeouts, err := cpstorage.GetChannelsUserTimeouts(channelIDs)
+	if err != nil {
+		return nil, err
+	}
+	userTimeoutsNumbers := map[string]int{}
+	for _, userTimeout := range userTimeouts {
+		userTimeoutsNumbers[userTimeout.ChannelID]++
+	}
+
+	description := i18n.T(locale, "list.empty")
+	if len(channelsProperties) > 0 {
+		lines := make([]string, len(channelsProperties))
+		for i, channelProperties := range channelsProperties {
+			lines[i] = formatListTimeoutsLine(locale, channelProperties, userTimeoutsNumbers[channelProperties.ChannelID])
+		}
+		description = strings.Join(lines, "\n")
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       i18n.T(locale, "list.title"),
+		Description: description,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: i18n.T(locale, "list.footer", page+1, pagesNumber, channelsNumber),
+		},
+	}
+
+	buttons := discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    i18n.T(locale, "list.previous"),
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("list-timeouts:%d", page-1),
+				Disabled: page == 0,
+			},
+			discordgo.Button{
+				Label:    i18n.T(locale, "list.next"),
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("list-timeouts:%d", page+1),
+				Disabled: page >= pagesNumber-1,
+			},
+		},
+	}
+
+	return &discordgo.InteractionResponseData{
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: []discordgo.MessageComponent{buttons},
+	}, nil
+}
+
+// Format channel as list line: channel, lifetime, next purge, last activity and number of user timeouts
+func formatListTimeoutsLine(locale string, channelProperties *cpstorage.ChannelPropertiesEntity, userTimeoutsNumber int) string {
+	nextRemove := i18n.T(locale, "list.purge-now")
+	if channelProperties.IsPaused(time.Now().Unix()) {
+		nextRemove = i18n.T(locale, "list.paused")
+		if channelProperties.PausedUntilDateUnix != cpstorage.PausedIndefinitely {
+			nextRemove = i18n.T(locale, "list.paused-until", channelProperties.PausedUntilDateUnix)
+		}
+	} else if channelProperties.NextRemoveDateUnix > time.Now().Unix() {
+		nextRemove = fmt.Sprintf("<t:%d:R>", channelProperties.NextRemoveDateUnix)
+	}
+
+	line := i18n.T(locale, "list.line",
+		channelProperties.ChannelID,
+		сonvertFloatHoursToTimeString(channelProperties.Timeout),
+		nextRemove,
+		channelProperties.LastActivityDateUnix)
+
+	if userTimeoutsNumber > 0 {
+		line += i18n.T(locale, "list.user-timeouts", userTimeoutsNumber)
+	}
+
+	return line
+}
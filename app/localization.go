@@ -0,0 +1,81 @@
+package main
+
+// Localization of commands and replies
+
+import (
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/i18n"
+)
+
+var (
+	// Language choices of set-language command: catalogue locale -> name of language in it
+	languageNames = map[string]string{
+		"en": "English",
+		"ru": "Русский",
+	}
+)
+
+// Get locale of replies to the interaction.
+// Guild language set by /set-language takes precedence over user language
+func getInteractionLocale(interaction *discordgo.InteractionCreate) string {
+	if interaction.GuildID != "" {
+		locale, err := cpstorage.GetGuildLocale(interaction.GuildID)
+		if err != nil {
+			log.Printf("Failed to get guild locale: %v", err)
+		} else if locale != "" {
+			return locale
+		}
+	}
+
+	return i18n.MatchLocale(string(interaction.Locale))
+}
+
+// Fill names, descriptions and their localizations of commands and options from catalogues.
+// descriptionArgs contains format arguments of descriptions by message key
+func localizeCommands(commands []*discordgo.ApplicationCommand, descriptionArgs map[string][]any) {
+	for _, command := range commands {
+		prefix := "command." + command.Name
+		command.Description = i18n.T(i18n.DefaultLocale, prefix+".description", descriptionArgs[prefix+".description"]...)
+		command.NameLocalizations = toDiscordLocales(i18n.Translations(prefix + ".name"))
+		command.DescriptionLocalizations = toDiscordLocales(i18n.Translations(prefix+".description", descriptionArgs[prefix+".description"]...))
+
+		for _, option := range command.Options {
+			// Options shared by several commands have common messages
+			optionPrefix := prefix + ".option." + option.Name
+			if !i18n.HasKey(optionPrefix + ".name") {
+				optionPrefix = "option." + option.Name
+			}
+
+			option.Description = i18n.T(i18n.DefaultLocale, optionPrefix+".description", descriptionArgs[optionPrefix+".description"]...)
+			option.NameLocalizations = *toDiscordLocales(i18n.Translations(optionPrefix + ".name"))
+			option.DescriptionLocalizations = *toDiscordLocales(i18n.Translations(optionPrefix+".description", descriptionArgs[optionPrefix+".description"]...))
+		}
+	}
+}
+
+// Convert translations to Discord locales format
+func toDiscordLocales(translations map[string]string) *map[discordgo.Locale]string {
+	localizations := map[discordgo.Locale]string{}
+	for locale, translation := range translations {
+		localizations[discordgo.Locale(locale)] = translation
+	}
+	return &localizations
+}
+
+// Create option to choose language of replies
+func newLanguageOption() *discordgo.ApplicationCommandOption {
+	option := &discordgo.ApplicationCommandOption{
+		Type: discordgo.ApplicationCommandOptionString,
+		Name: "language",
+	}
+	for _, locale := range i18n.Locales() {
+		option.Choices = append(option.Choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  languageNames[locale],
+			Value: locale,
+		})
+	}
+	return option
+}
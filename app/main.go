@@ -7,50 +7,75 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"slices"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/mdpakhmurin/discord-outdate-delete-bot/cfgloader"
 	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/i18n"
 )
 
 var (
-	Session        *discordgo.Session
+	Session        *discordgo.Session // Session of the first shard of this process. Used for REST requests
 	SharedDataPath = "./data"
-	Config         cfgloader.Config
+	configWatcher  *cfgloader.Watcher // Keeps current config snapshot, reloads it on change
 )
 
-func init() {
-	loadConfig()
-	loadSession()
-	RegisterHandlers()
-}
-
 // Load gloabal config
 func loadConfig() {
-	var err error
+	configPath := SharedDataPath + "/config.ini"
 
 	// Try to load config
-	Config, err = cfgloader.LoadConfig(SharedDataPath + "/config.ini")
+	config, warnings, err := cfgloader.LoadConfig(configPath)
+	for _, warning := range warnings {
+		log.Printf("Config warning: %s", warning)
+	}
 	if err != nil {
-		log.Fatalf("Failed to load config, %v", err)
+		log.Fatalf("Failed to load config:\n%v", err)
 	}
 
 	// Beauty print loaded config
-	cfgJSON, err := json.MarshalIndent(Config, "", "  ")
+	cfgJSON, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
 		log.Fatalf("Failed to marshal config: %v", err)
 	}
 
 	log.Printf("Config loaded: %s\n", cfgJSON)
+
+	configWatcher = cfgloader.NewWatcher(configPath, config)
 }
 
-// Conntect to bot. Load session
-func loadSession() {
-	var err error
-	Session, err = discordgo.New(Config.BotToken)
-	if err != nil {
-		log.Fatalf("Invalid bot parameters: %v", err)
+// Get current config snapshot. Snapshot can be replaced at any moment by reload, so do not cache it for long
+func currentConfig() *cfgloader.Config {
+	return configWatcher.Config()
+}
+
+// Apply reloaded config to running bot
+func onConfigReload(oldCfg, newCfg *cfgloader.Config) {
+	if !isMainShardProcess() {
+		return
+	}
+
+	// Commands are no longer registered in guilds that left commands scope
+	newGuildIDs := getCommandsGuildIDs(newCfg)
+	for _, guildID := range getCommandsGuildIDs(oldCfg) {
+		if !slices.Contains(newGuildIDs, guildID) {
+			RemoveGuildCommands(guildID)
+		}
+	}
+
+	// Limits of timeout are part of commands definitions. Unchanged commands are not touched by sync
+	SyncCommands()
+}
+
+// Get storage driver and data source (database file or connection string) from config
+func storageDataSource() (driver string, dataSource string) {
+	config := currentConfig()
+	if config.StorageDriver == cpstorage.DriverPostgres {
+		return config.StorageDriver, config.PostgresDSN
 	}
+	return cpstorage.DriverSQLite, SharedDataPath + "/channels.db"
 }
 
 // Wait ctrl+c to exit
@@ -77,26 +102,57 @@ func setupLogToFile(logFilePath string) (file *os.File) {
 }
 
 func main() {
-	cpstorage.Init(SharedDataPath)
+	// Run subcommand instead of the bot if it is specified
+	if len(os.Args) > 1 {
+		os.Exit(runSubcommand(os.Args[1], os.Args[2:]))
+	}
+
+	// Missing translation would show message key to users
+	if err := i18n.CheckCatalogues(); err != nil {
+		log.Fatalf("Invalid message catalogues:\n%v", err)
+	}
+
+	loadConfig()
+	loadSessions()
+	RegisterHandlers()
+
+	storageDriver, storageSource := storageDataSource()
+	if storageDriver == cpstorage.DriverSQLite {
+		restoreCorruptedDatabase(storageSource)
+	}
+	cpstorage.Init(storageDriver, storageSource)
+	defer cpstorage.Close()
 
-	if Config.IsLogToFile {
+	if currentConfig().IsLogToFile {
 		file := setupLogToFile(SharedDataPath + "/log.txt")
 		defer file.Close()
 	}
 
-	// Open discord session
-	err := Session.Open()
-	if err != nil {
-		log.Fatal("Error when opening a bot session: ", err)
-	}
-	defer Session.Close()
+	// Open discord sessions
+	openSessions()
+	defer closeSessions()
 
-	registeredCommands := RegisterCommands()
-	if Config.IsRemoveCommandsAfterExit {
-		defer RemoveCommands(registeredCommands)
+	if isMainShardProcess() {
+		SyncCommands()
+		if currentConfig().IsRemoveCommandsAfterExit {
+			defer RemoveCommands()
+		}
 	}
 
+	configWatcher.OnReload(onConfigReload)
+	go configWatcher.Run(5 * time.Second)
+
+	if isMainShardProcess() {
+		go BackfillChannelsGuilds()
+	}
 	go RemoveOldMessages()
+	go RemoveExpiringMessages()
+	go RunThreadCleanups()
+	if storageDriver == cpstorage.DriverSQLite {
+		go RunBackups()
+	}
+
+	StartAdminAPI()
 
 	waitForExit()
 }
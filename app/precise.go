@@ -0,0 +1,320 @@
+package main
+
+// Precise mode. Every message of channel is deleted by its own timer exactly when it becomes outdated
+
+import (
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+const (
+	preciseBatchDelay       = time.Second     // Messages expiring within this delay are deleted by one request
+	preciseRemoverDelay     = 5 * time.Minute // Delay after which the remover deletes messages missed by timers
+	preciseDeleteLimit      = 500             // Maximum number of messages deleted in channel at once
+	preciseReconcilePages   = 10              // Maximum number of history pages checked in channel at startup
+	preciseReconcilePageLen = 100             // Number of messages in history page
+)
+
+var (
+	expiringSchedule = newChannelsSchedule() // Channels with expiring messages of this process
+)
+
+// Delete expiring messages of precise channels when they become outdated
+func RemoveExpiringMessages() {
+	reconcileExpiringMessages()
+
+	var reloadDate time.Time
+	for {
+		// Storage is the source of truth, messages could be saved by another process
+		if time.Now().After(reloadDate) {
+			loadExpiringSchedule()
+			reloadDate = time.Now().Add(scheduleFallbackInterval)
+		}
+
+		expiringSchedule.wait(time.Until(reloadDate))
+
+		// Neighbour messages are deleted together
+		time.Sleep(preciseBatchDelay)
+
+		nowUnix := time.Now().Unix()
+		for _, channelID := range expiringSchedule.removeDue(nowUnix) {
+			deleteExpiredChannelMessages(channelID, nowUnix)
+		}
+	}
+}
+
+// Schedule channels of this process with expiring messages from storage
+func loadExpiringSchedule() {
+	expireDates, err := cpstorage.GetChannelsNextExpireDates()
+	if err != nil {
+		log.Printf("Failed to load expiring messages schedule: %v", err)
+		return
+	}
+
+	for _, expireDate := range expireDates {
+		channelProperties := &cpstorage.ChannelPropertiesEntity{ChannelID: expireDate.ChannelID, GuildID: expireDate.GuildID}
+		if isOwnChannel(channelProperties) {
+			expiringSchedule.setNotLater(expireDate.ChannelID, expireDate.ExpireDateUnix)
+		}
+	}
+}
+
+// Save new message of precise channel and schedule its deletion at expire date (unixtime)
+func scheduleExpiringMessage(message *discordgo.Message, expireDateUnix int64) {
+	if len(filterRemovableMessages([]*discordgo.Message{message})) == 0 {
+		return
+	}
+
+	err := cpstorage.WriteExpiringMessages([]*cpstorage.ExpiringMessageEntity{newExpiringMessage(message, expireDateUnix)})
+	if err != nil {
+		log.Printf("Failed to save expiring message %s: %v", message.ID, err)
+		return
+	}
+	expiringSchedule.setNotLater(message.ChannelID, expireDateUnix)
+}
+
+func newExpiringMessage(message *discordgo.Message, expireDateUnix int64) *cpstorage.ExpiringMessageEntity {
+	expiringMessage := &cpstorage.ExpiringMessageEntity{
+		ChannelID:      message.ChannelID,
+		MessageID:      message.ID,
+		ExpireDateUnix: expireDateUnix,
+	}
+	if message.Author != nil {
+		expiringMessage.AuthorID = message.Author.ID
+	}
+	return expiringMessage
+}
+
+// Delete messages of channel expired at the date (unixtime) and schedule the next deletion
+func deleteExpiredChannelMessages(channelID string, momentUnix int64) {
+	channelProperties, err := cpstorage.GetChannelProperties(channelID)
+	if err != nil {
+		log.Printf("Failed to get channel %s: %v", channelID, err)
+		expiringSchedule.set(channelID, time.Now().Add(failedPassRetryDelay).Unix())
+		return
+	} else if channelProperties == nil || !channelProperties.IsPrecise {
+		// Timeout was removed or precise mode was turned off
+		err = cpstorage.DeleteChannelExpiringMessages(channelID)
+		if err != nil {
+			log.Printf("Failed to delete expiring messages of channel %s: %v", channelID, err)
+		}
+		return
+	} else if channelProperties.IsPaused(momentUnix) {
+		// Messages expired during pause are deleted when it ends
+		if channelProperties.PausedUntilDateUnix != cpstorage.PausedIndefinitely {
+			expiringSchedule.set(channelID, channelProperties.PausedUntilDateUnix)
+		}
+		return
+	}
+
+	expiringMessages, err := cpstorage.GetChannelExpiringMessagesBeforeMoment(channelID, momentUnix, preciseDeleteLimit)
+	if err == nil {
+		err = deleteExpiringMessages(channelProperties, expiringMessages)
+	}
+	if err != nil && isErrorChannelUnavailable(err) {
+		// Channel is deleted by the remover
+		err = cpstorage.DeleteChannelExpiringMessages(channelID)
+		if err != nil {
+			log.Printf("Failed to delete expiring messages of channel %s: %v", channelID, err)
+		}
+		return
+	} else if err != nil {
+		log.Printf("Failed to delete expiring messages of channel %s: %v", channelID, err)
+		expiringSchedule.set(channelID, time.Now().Add(failedPassRetryDelay).Unix())
+		return
+	}
+
+	nextExpireDateUnix, isFound, err := cpstorage.GetChannelNextExpireDate(channelID)
+	if err != nil {
+		log.Printf("Failed to get next expire date of channel %s: %v", channelID, err)
+		expiringSchedule.set(channelID, time.Now().Add(failedPassRetryDelay).Unix())
+	} else if isFound {
+		expiringSchedule.set(channelID, nextExpireDateUnix)
+	}
+}
+
+// Delete expired messages of channel. Lifetimes are checked again, they could be changed after messages were saved
+func deleteExpiringMessages(channelProperties *cpstorage.ChannelPropertiesEntity, expiringMessages []*cpstorage.ExpiringMessageEntity) (err error) {
+	if len(expiringMessages) == 0 {
+		return nil
+	}
+	channelID := channelProperties.ChannelID
+
+	userTimeouts, err := cpstorage.GetChannelUserTimeouts(channelID)
+	if err != nil {
+		return err
+	}
+	lifetimes := newChannelLifetimes(channelProperties, userTimeouts)
+
+	// Messages are fetched to know which of them are pinned or started threads
+	messages, err := getExpiringMessagesFromChannel(channelID, expiringMessages)
+	if err != nil {
+		return err
+	}
+	removableMessages := make(map[string]*discordgo.Message, len(messages))
+	for _, message := range filterRemovableMessages(messages) {
+		removableMessages[message.ID] = message
+	}
+
+	var messagesToDelete []*discordgo.Message
+	var messageIDsToForget []string
+	var postponedMessages []*cpstorage.ExpiringMessageEntity
+	for _, expiringMessage := range expiringMessages {
+		sendDate, err := discordgo.SnowflakeTimestamp(expiringMessage.MessageID)
+		if err != nil {
+			messageIDsToForget = append(messageIDsToForget, expiringMessage.MessageID)
+			continue
+		}
+		expireDate := sendDate.Add(time.Duration(lifetimes.userTimeout(expiringMessage.AuthorID) * float64(time.Hour)))
+
+		message, isRemovable := removableMessages[expiringMessage.MessageID]
+		switch {
+		case !isRemovable:
+			// Message is already deleted, pinned or too old
+			messageIDsToForget = append(messageIDsToForget, expiringMessage.MessageID)
+		case expireDate.After(time.Now()):
+			expiringMessage.ExpireDateUnix = expireDate.Unix()
+			postponedMessages = append(postponedMessages, expiringMessage)
+		default:
+			messagesToDelete = append(messagesToDelete, message)
+		}
+	}
+
+	_, err = deleteChannelMessages(channelProperties, messagesToDelete)
+	if err != nil {
+		return err
+	}
+
+	messageIDsToDelete := make([]string, len(messagesToDelete))
+	for i, message := range messagesToDelete {
+		messageIDsToDelete[i] = message.ID
+	}
+	err = cpstorage.DeleteExpiringMessages(channelID, append(messageIDsToDelete, messageIDsToForget...))
+	if err != nil {
+		return err
+	}
+	return cpstorage.WriteExpiringMessages(postponedMessages)
+}
+
+// Get messages of channel between the oldest and the newest of expiring messages.
+// Messages that are not returned are already deleted
+func getExpiringMessagesFromChannel(channelID string, expiringMessages []*cpstorage.ExpiringMessageEntity) (messages []*discordgo.Message, err error) {
+	oldestMessageID, newestMessageID := expiringMessages[0].MessageID, expiringMessages[0].MessageID
+	for _, expiringMessage := range expiringMessages {
+		if isSnowflakeIdBefore(expiringMessage.MessageID, oldestMessageID) {
+			oldestMessageID = expiringMessage.MessageID
+		}
+		if isSnowflakeIdBefore(newestMessageID, expiringMessage.MessageID) {
+			newestMessageID = expiringMessage.MessageID
+		}
+	}
+
+	oldestSendDate, err := discordgo.SnowflakeTimestamp(oldestMessageID)
+	if err != nil {
+		return nil, err
+	}
+	afterSnowflakeId := TimestampToSnowflakeId(oldestSendDate.Add(-time.Millisecond))
+
+	for {
+		fetchedMessages, err := Session.ChannelMessages(channelID, preciseReconcilePageLen, "", afterSnowflakeId, "")
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, fetchedMessages...)
+
+		// Messages are returned from the newest to the oldest. Next page starts after the newest one
+		if len(fetchedMessages) < preciseReconcilePageLen || !isSnowflakeIdBefore(fetchedMessages[0].ID, newestMessageID) {
+			return messages, nil
+		}
+		afterSnowflakeId = fetchedMessages[0].ID
+	}
+}
+
+// Check if snowflake id a was created before snowflake id b
+func isSnowflakeIdBefore(a string, b string) (isBefore bool) {
+	return len(a) < len(b) || len(a) == len(b) && a < b
+}
+
+// Save messages of precise channels sent while the bot was offline
+func reconcileExpiringMessages() {
+	channelsProperties, err := cpstorage.GetAllChannelsProperties()
+	if err != nil {
+		log.Printf("Failed to get channels for reconciliation: %v", err)
+		return
+	}
+
+	for _, channelProperties := range channelsProperties {
+		if channelProperties.IsPrecise && isOwnChannel(channelProperties) {
+			reconcileChannelExpiringMessages(channelProperties)
+		}
+	}
+}
+
+// Save messages of precise channel that are not outdated yet, from channel history
+func reconcileChannelExpiringMessages(channelProperties *cpstorage.ChannelPropertiesEntity) {
+	channelID := channelProperties.ChannelID
+
+	userTimeouts, err := cpstorage.GetChannelUserTimeouts(channelID)
+	if err != nil {
+		log.Printf("Failed to get user timeouts %s: %v", channelID, err)
+		return
+	}
+	lifetimes := newChannelLifetimes(channelProperties, userTimeouts)
+
+	// Older messages are already outdated by any lifetime, they are deleted by the remover
+	afterSnowflakeId := TimestampToSnowflakeId(time.Now().Add(-time.Duration(lifetimes.longestTimeout() * float64(time.Hour))))
+
+	savedNumber := 0
+	for page := 0; page < preciseReconcilePages; page++ {
+		messages, err := Session.ChannelMessages(channelID, preciseReconcilePageLen, "", afterSnowflakeId, "")
+		if err != nil {
+			log.Printf("Failed to get messages of channel %s for reconciliation: %v", channelID, err)
+			return
+		}
+		if len(messages) == 0 {
+			break
+		}
+
+		var expiringMessages []*cpstorage.ExpiringMessageEntity
+		for _, message := range filterRemovableMessages(messages) {
+			message.ChannelID = channelID
+			expireDate := message.Timestamp.Add(time.Duration(lifetimes.messageTimeout(message) * float64(time.Hour)))
+			expiringMessages = append(expiringMessages, newExpiringMessage(message, expireDate.Unix()))
+		}
+		err = cpstorage.WriteExpiringMessages(expiringMessages)
+		if err != nil {
+			log.Printf("Failed to save expiring messages of channel %s: %v", channelID, err)
+			return
+		}
+		savedNumber += len(expiringMessages)
+
+		// Messages are returned from the newest to the oldest. Next page starts after the newest one
+		afterSnowflakeId = messages[0].ID
+		if len(messages) < preciseReconcilePageLen {
+			break
+		}
+	}
+
+	if savedNumber > 0 {
+		log.Printf("Reconciled %d expiring messages of channel %s", savedNumber, channelID)
+	}
+}
+
+// Triggered when a message is deleted. Deleted message must not be deleted again
+func MessageDeleteHandler(session *discordgo.Session, event *discordgo.MessageDelete) {
+	err := cpstorage.DeleteExpiringMessages(event.ChannelID, []string{event.ID})
+	if err != nil {
+		log.Printf("Failed to delete expiring message %s: %v", event.ID, err)
+	}
+}
+
+// Triggered when messages are deleted by bulk delete
+func MessageDeleteBulkHandler(session *discordgo.Session, event *discordgo.MessageDeleteBulk) {
+	err := cpstorage.DeleteExpiringMessages(event.ChannelID, event.Messages)
+	if err != nil {
+		log.Printf("Failed to delete expiring messages of channel %s: %v", event.ChannelID, err)
+	}
+}
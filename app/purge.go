@@ -0,0 +1,182 @@
+package main
+
+// Immediate removing of outdated messages by command
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/i18n"
+)
+
+const purgeFetchSize = 100 // Maximum number of messages Discord returns per request
+
+var (
+	activePurges sync.Map // IDs of channels that are being purged now. Only one purge per channel
+)
+
+// Parameters of purge
+type purgeOptions struct {
+	ChannelID     string
+	OlderThanDate time.Time // Only messages sent before this date are removed
+	Limit         int       // Maximum number of messages to remove. 0 - no limit
+	UserID        string    // Remove only messages of this user. Empty - of all users
+}
+
+// Result of purge
+type purgeResult struct {
+	MessagesNumber int // Number of removed messages
+	ThreadsNumber  int // Number of threads queued for cleanup
+}
+
+// Purge now command handler.
+// Purge runs in background, the response is deferred and edited with progress
+func PurgeNowCommandHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	channelID, isAllowed := resolveTargetChannel(session, interaction, manageTimeoutPermissions, botRemovePermissions)
+	if !isAllowed {
+		return
+	}
+
+	locale := getInteractionLocale(interaction)
+	options := purgeOptions{ChannelID: channelID}
+	commandOptions := getCommandOptions(interaction)
+
+	// Channel timeout is used if age is not specified
+	olderThanHours, isSet, invalidMessage := getDurationOption(interaction, "older-than")
+	if invalidMessage != "" {
+		responseToCommand(invalidMessage, session, interaction)
+		return
+	} else if isSet {
+		options.OlderThanDate = time.Now().Add(-time.Duration(olderThanHours * float64(time.Hour)))
+	} else {
+		channelProperties, err := cpstorage.GetChannelProperties(channelID)
+		if err != nil {
+			log.Printf("Failed to get timeout: %v", err)
+			responseToCommand(i18n.T(locale, "error.get-timeout"), session, interaction)
+			return
+		} else if channelProperties == nil {
+			responseToCommand(i18n.T(locale, "purge.no-timeout", channelID), session, interaction)
+			return
+		}
+		options.OlderThanDate = time.Now().Add(-time.Duration(channelProperties.Timeout * float64(time.Hour)))
+	}
+	if option, ok := commandOptions["limit"]; ok {
+		options.Limit = int(option.IntValue())
+	}
+	if option, ok := commandOptions["user"]; ok {
+		options.UserID = option.UserValue(nil).ID
+	}
+
+	if _, isActive := activePurges.LoadOrStore(channelID, true); isActive {
+		responseToCommand(i18n.T(locale, "purge.running", channelID), session, interaction)
+		return
+	}
+
+	err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		activePurges.Delete(channelID)
+		log.Printf("Failed to defer purge-now response: %v", err)
+		return
+	}
+
+	writeInteractionAuditEntry(interaction, channelID, formatAuditPurge(options))
+
+	go func() {
+		defer activePurges.Delete(channelID)
+
+		result, err := purgeChannel(options, func(progress purgeResult) {
+			editCommandResponse(i18n.T(locale, "purge.progress", progress.MessagesNumber, progress.ThreadsNumber), session, interaction)
+		})
+
+		responseMessage := i18n.T(locale, "purge.done", result.MessagesNumber, result.ThreadsNumber, channelID)
+		if err != nil {
+			log.Printf("Failed to purge channel %s: %v", channelID, err)
+			responseMessage = i18n.T(locale, "purge.failed", result.MessagesNumber, result.ThreadsNumber, channelID)
+		}
+		editCommandResponse(responseMessage, session, interaction)
+	}()
+}
+
+// Format purge parameters for audit
+func formatAuditPurge(options purgeOptions) string {
+	details := "older than " + options.OlderThanDate.UTC().Format(time.RFC3339)
+	if options.Limit > 0 {
+		details += fmt.Sprintf(", limit %d", options.Limit)
+	}
+	if options.UserID != "" {
+		details += ", user " + options.UserID
+	}
+	return details
+}
+
+// Remove all removable messages sent before the date, from the newest to the oldest.
+// onProgress is called after each removed batch
+func purgeChannel(options purgeOptions, onProgress func(progress purgeResult)) (result purgeResult, err error) {
+	beforeID := TimestampToSnowflakeId(options.OlderThanDate)
+	tooOldSnowflakeId := getTooOldTimeInSnoflakeIdFormat()
+
+	// Channel may have no timeout, then its threads are always deleted
+	channelProperties, err := cpstorage.GetChannelProperties(options.ChannelID)
+	if err != nil {
+		return result, err
+	} else if channelProperties == nil {
+		channelProperties = &cpstorage.ChannelPropertiesEntity{ChannelID: options.ChannelID}
+	}
+
+	for options.Limit == 0 || result.MessagesNumber < options.Limit {
+		fetchedMessages, err := Session.ChannelMessages(options.ChannelID, purgeFetchSize, beforeID, "", "")
+		if err != nil {
+			return result, err
+		}
+		if len(fetchedMessages) == 0 {
+			break
+		}
+
+		// Messages are returned from the newest to the oldest. Next batch starts after the oldest one
+		beforeID = fetchedMessages[len(fetchedMessages)-1].ID
+
+		messages := filterRemovableMessages(fetchedMessages)
+		if options.UserID != "" {
+			messages = filterUserMessages(messages, options.UserID)
+		}
+		if options.Limit != 0 && len(messages) > options.Limit-result.MessagesNumber {
+			messages = messages[:options.Limit-result.MessagesNumber]
+		}
+
+		if len(messages) > 0 {
+			queuedThreadsNumber, err := deleteChannelMessages(channelProperties, messages)
+			result.ThreadsNumber += queuedThreadsNumber
+			if err != nil {
+				return result, err
+			}
+			result.MessagesNumber += len(messages)
+			onProgress(result)
+		}
+
+		// Older messages can't be removed anyway
+		if len(fetchedMessages) < purgeFetchSize || beforeID < tooOldSnowflakeId {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// Filter messages of the user
+func filterUserMessages(messages []*discordgo.Message, userID string) (filteredMessages []*discordgo.Message) {
+	for _, message := range messages {
+		if message.Author != nil && message.Author.ID == userID {
+			filteredMessages = append(filteredMessages, message)
+		}
+	}
+	return filteredMessages
+}
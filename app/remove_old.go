@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"time"
 
@@ -9,76 +8,169 @@ import (
 	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
 )
 
+const (
+	maxRemoveFetchPages = 5 // Maximum number of pages without messages to remove checked after all lifetimes are over
+
+	minBulkDeleteMessages = 2   // Discord bulk deletes at least 2 messages per request
+	maxBulkDeleteMessages = 100 // Discord bulk deletes at most 100 messages per request
+)
+
+// Delete outdated messages in channels when they are due. Storage is the source of truth,
+// the in-memory schedule only tells when to look at it
 func RemoveOldMessages() {
+	catchUpAfterDowntime()
+	loadRemoveSchedule()
+
 	for {
-		channelIdsForRemove, err := cpstorage.GetChannelsIdsWithRemoveDateBeforeMoment(time.Now().Unix())
+		writeHeartbeat()
+		removeSchedule.wait(scheduleFallbackInterval)
+
+		nowUnix := time.Now().Unix()
+		removeSchedule.removeDue(nowUnix)
+		// Channel is processed by process running shard of its guild. Channels are ordered by deadline
+		channelsForRemove, err := cpstorage.GetChannelsWithRemoveDateBeforeMoment(nowUnix, getOwnShardFilter())
 		if err != nil {
 			log.Fatalf("Failed to get channels for remove: %v", err)
 		}
+		updateDeadlineMetrics(channelsForRemove)
+
+		for _, channelForRemove := range channelsForRemove {
 
-		for _, channelId := range channelIdsForRemove {
+			channelId := channelForRemove.ChannelID
 			isChannelToDelete := false
 
+			// Channel is checked again later if the pass fails
+			removeSchedule.set(channelId, time.Now().Add(failedPassRetryDelay).Unix())
+
 			channelProperties, err := cpstorage.GetChannelProperties(channelId)
 			if err != nil {
 				log.Printf("Failed to get channel %s: %v", channelId, err)
+				continue
+			} else if channelProperties == nil {
+				// Channel was deleted by command after the list was taken
+				removeSchedule.remove(channelId)
+				continue
+			}
+
+			// Pause has ended, deleting is resumed automatically
+			if channelProperties.PausedUntilDateUnix != 0 {
+				err = cpstorage.ResumeChannel(channelId, time.Now().Unix())
+				if err != nil {
+					log.Printf("Failed to resume channel %s: %v", channelId, err)
+					continue
+				}
+				log.Printf("Channel %s is resumed after pause", channelId)
+
+				// Resume changed version of the channel, the pass must be based on the new one
+				channelProperties, err = cpstorage.GetChannelProperties(channelId)
+				if err != nil {
+					log.Printf("Failed to get channel %s: %v", channelId, err)
+					continue
+				} else if channelProperties == nil {
+					removeSchedule.remove(channelId)
+					continue
+				}
 			}
 
+			// Users may have own timeouts in the channel
+			userTimeouts, err := cpstorage.GetChannelUserTimeouts(channelId)
+			if err != nil {
+				log.Printf("Failed to get user timeouts %s: %v", channelId, err)
+				continue
+			}
+			lifetimes := newChannelLifetimes(channelProperties, userTimeouts)
+
+			// In precise mode messages are deleted by their own timers, the pass only catches what was missed
+			if channelProperties.IsPrecise {
+				lifetimes = lifetimes.withDelay(preciseRemoverDelay)
+			}
+
+			// Messages are fetched and scheduled by the shortest lifetime in the channel
+			shortestLifetimeProperties := *channelProperties
+			shortestLifetimeProperties.Timeout = lifetimes.shortestTimeout()
+
 			// Get outdate messages.
-			messages, err := getChannelMessagesForRemove(channelProperties)
+			messages, err := getChannelMessagesForRemove(&shortestLifetimeProperties, lifetimes)
 
-			// Unavailable channels must be deleted
+			// Unavailable channels must be deleted. Other failed channels are checked again after retry delay
+			isPassFailed := false
 			if err != nil && isErrorChannelUnavailable(err) {
 				log.Printf("Channel %s is unavaliable", channelId)
 				isChannelToDelete = true
 			} else if err != nil {
 				log.Printf("Failed to get messages: %v", err)
+				isPassFailed = true
 			}
 
-			// Delete outdate messages
-			err = deleteChannelMessages(channelId, messages)
-			if err != nil {
-				log.Printf("Failed to delete messages: %v", err)
+			// Delete outdate messages. Bot that lost permission to delete messages can't serve the channel
+			isMessagesDeleted := false
+			if !isChannelToDelete {
+				_, err = deleteChannelMessages(channelProperties, messages)
+				if err != nil && isErrorChannelUnavailable(err) {
+					log.Printf("Channel %s is unavaliable: %v", channelId, err)
+					isChannelToDelete = true
+				} else if err != nil {
+					log.Printf("Failed to delete messages in channel %s: %v", channelId, err)
+					isPassFailed = true
+				} else {
+					isMessagesDeleted = len(messages) > 0
+				}
 			}
 
 			// Update last activity if there are deleted messages
-			if len(messages) > 0 {
+			if isMessagesDeleted {
 				channelProperties.LastActivityDateUnix = time.Now().Unix()
 			}
 
 			// Get next remove date in unix format
-			nextRemoveDateUnix, err := getNextRemoveDateUnix(len(messages) > 0, channelProperties)
-			if err != nil {
-				fmt.Printf("Failed to get next remove date: %v", err)
-				nextRemoveDateUnix = 0
+			var nextRemoveDateUnix int64
+			if !isPassFailed {
+				nextRemoveDateUnix, err = getNextRemoveDateUnix(isMessagesDeleted, &shortestLifetimeProperties)
+				if err != nil && !isChannelToDelete {
+					log.Printf("Failed to get next remove date of channel %s: %v", channelId, err)
+					isPassFailed = true
+				}
+			}
+
+			// Failed channel is saved as due after retry delay, so it is not checked again at every wake of the remover
+			if isPassFailed {
+				nextRemoveDateUnix = time.Now().Add(failedPassRetryDelay).Unix()
 			}
 			channelProperties.NextRemoveDateUnix = nextRemoveDateUnix
 
+			// Without backlog the oldest message waiting for deletion is the next one to become outdated.
+			// With backlog its deadline is kept, messages are fetched from the newest and the oldest ones are still there
+			if nextRemoveDateUnix != 0 && !isPassFailed {
+				oldestMessageDate := time.Unix(nextRemoveDateUnix, 0).Add(-time.Duration(shortestLifetimeProperties.Timeout * float64(time.Hour)))
+				channelProperties.DeadlineDateUnix = getBulkDeleteDeadline(oldestMessageDate).Unix()
+			}
+			warnIfDeadlineAtRisk(channelProperties, len(messages) >= currentConfig().RemoveBatchSize)
+
 			// Inactive channels must be deleted
 			if isChannelInactive(channelProperties) {
 				isChannelToDelete = true
 			}
 
-			// Update channel properties
-			err = cpstorage.UpdateChannelLastActivityDate(channelId, channelProperties.LastActivityDateUnix)
+			// Save channel state. Changes made by commands during the pass take precedence
+			isApplied, err := cpstorage.CompletePurgePass(&cpstorage.PurgePassResult{
+				ChannelID:            channelId,
+				Version:              channelProperties.Version,
+				LastActivityDateUnix: channelProperties.LastActivityDateUnix,
+				NextRemoveDateUnix:   channelProperties.NextRemoveDateUnix,
+				DeadlineDateUnix:     channelProperties.DeadlineDateUnix,
+				IsChannelToDelete:    isChannelToDelete,
+			})
 			if err != nil {
-				log.Printf("Failed to update channel last activity %s: %v", channelId, err)
-			}
-			err = cpstorage.UpdateChannelNextRemoveDate(channelId, channelProperties.NextRemoveDateUnix)
-			if err != nil {
-				log.Printf("Failed to update channel next remove date %s: %v", channelId, err)
-			}
-
-			// Delete channel
-			if isChannelToDelete {
-				err = cpstorage.DeleteChannelProperties(channelId)
-				if err != nil {
-					log.Printf("Failed to delete channel %s: %v", channelId, err)
-				}
+				log.Printf("Failed to save channel %s after purge pass: %v", channelId, err)
+			} else if !isApplied {
+				log.Printf("Channel %s was changed during purge pass, its new state is kept", channelId)
+				removeSchedule.set(channelId, 0)
+			} else if isChannelToDelete {
+				removeSchedule.remove(channelId)
+			} else {
+				removeSchedule.set(channelId, channelProperties.NextRemoveDateUnix)
 			}
 		}
-
-		time.Sleep(3 * time.Second)
 	}
 }
 
@@ -89,6 +181,14 @@ func getNextRemoveDateUnix(isMessagesToRemoveExists bool, channelProperties *cps
 		return 0, nil
 	}
 
+	// Messages are tracked by MessageCreate. If there was no activity after outdate time, there are no newer messages
+	timeout := time.Duration(channelProperties.Timeout * float64(time.Hour))
+	outdateDateUnix := time.Now().Add(-timeout).Unix()
+	messageEventsSinceUnix := messageEventsSinceDateUnix.Load()
+	if messageEventsSinceUnix != 0 && outdateDateUnix >= messageEventsSinceUnix && outdateDateUnix >= channelProperties.LastActivityDateUnix {
+		return time.Now().Add(timeout).Unix(), nil
+	}
+
 	// get a message that will be deleted next in the future
 	messagesAfterOutdate, err := getChannelMessagesAfterOutdateTime(1, channelProperties)
 	if err != nil {
@@ -115,7 +215,7 @@ func getNextRemoveDateUnix(isMessagesToRemoveExists bool, channelProperties *cps
 // Check if there has been chat activity for too long
 func isChannelInactive(channelProperties *cpstorage.ChannelPropertiesEntity) (isInactive bool) {
 	timeScienceLastActivity := time.Since(time.Unix(channelProperties.LastActivityDateUnix, 0))
-	return timeScienceLastActivity.Hours() > Config.RemoveInactiveChannelTimeoutHours
+	return timeScienceLastActivity.Hours() > currentConfig().RemoveInactiveChannelTimeoutHours
 }
 
 // Check is error of getting messages from channel is access problem
@@ -131,25 +231,62 @@ func isErrorChannelUnavailable(discordMessageGetError error) (isUnavailable bool
 	return false
 }
 
-// Get messages that must be removed
-func getChannelMessagesForRemove(channelProperties *cpstorage.ChannelPropertiesEntity) (messages []*discordgo.Message, err error) {
-	outdateSnwoflakeId := getChannelOutdateTimeInSnowflakeIdFormat(channelProperties)
+// Get messages that must be removed.
+// Messages older than channel timeout are fetched and then checked by the lifetime of their authors.
+// If a page has no messages for removing (pinned, authors with longer lifetime), older pages are checked.
+// Pages are checked until the longest lifetime is over, so messages of every author are reached
+func getChannelMessagesForRemove(channelProperties *cpstorage.ChannelPropertiesEntity, lifetimes channelLifetimes) (messages []*discordgo.Message, err error) {
+	beforeSnowflakeId := getChannelOutdateTimeInSnowflakeIdFormat(channelProperties)
+	tooOldSnowflakeId := getTooOldTimeInSnoflakeIdFormat()
+	longestOutdateSnowflakeId := TimestampToSnowflakeId(time.Now().Add(-time.Duration(lifetimes.longestTimeout() * float64(time.Hour))))
+	batchSize := currentConfig().RemoveBatchSize
+
+	// Older messages are outdated by any lifetime, pages of them are full of messages to remove
+	// unless messages can't be removed (pinned, thread starts)
+	pagesAfterLongestOutdate := 0
+	for pagesAfterLongestOutdate < maxRemoveFetchPages && len(messages) < batchSize {
+		if !isSnowflakeIdBefore(longestOutdateSnowflakeId, beforeSnowflakeId) {
+			pagesAfterLongestOutdate++
+		}
 
-	messages, err = Session.ChannelMessages(channelProperties.ChannelID, Config.RemoveBatchSize, outdateSnwoflakeId, "", "")
-	if err != nil {
-		return messages, err
+		fetchedMessages, err := Session.ChannelMessages(channelProperties.ChannelID, batchSize, beforeSnowflakeId, "", "")
+		if err != nil {
+			return messages, err
+		}
+		if len(fetchedMessages) == 0 {
+			break
+		}
+
+		// Messages are returned from the newest to the oldest. Next page starts after the oldest one
+		beforeSnowflakeId = fetchedMessages[len(fetchedMessages)-1].ID
+
+		messages = append(messages, lifetimes.filterOutdatedMessages(filterRemovableMessages(fetchedMessages))...)
+
+		// Older messages can't be removed anyway
+		if len(fetchedMessages) < batchSize || isSnowflakeIdBefore(beforeSnowflakeId, tooOldSnowflakeId) {
+			break
+		}
 	}
 
+	if len(messages) > batchSize {
+		messages = messages[:batchSize]
+	}
+
+	return messages, nil
+}
+
+// Exclude messages that must not or can not be removed
+func filterRemovableMessages(messages []*discordgo.Message) (filteredMessages []*discordgo.Message) {
 	// Too old messages cannot be deleted. Bad work if use old id in ChannelMessages
-	messages = excludeTooOldMessages(messages)
+	filteredMessages = excludeTooOldMessages(messages)
 
 	// Pinned messages will not be deleted
-	messages = excludePinnedMessages(messages)
+	filteredMessages = excludePinnedMessages(filteredMessages)
 
 	// First message in thread can not be deleted
-	messages = excludeThreadStartMessages(messages)
+	filteredMessages = excludeThreadStartMessages(filteredMessages)
 
-	return messages, nil
+	return filteredMessages
 }
 
 // Get messages that were sent after outdate time
@@ -170,7 +307,7 @@ func getChannelOutdateTimeInSnowflakeIdFormat(channelProperties *cpstorage.Chann
 
 // Get time when messages became too old and can not be deleted
 func getTooOldTimeInSnoflakeIdFormat() (snowflakeId string) {
-	tooOldTimeStamp := time.Now().Add(-time.Hour * time.Duration(Config.OldDontRemoveTimeoutHours))
+	tooOldTimeStamp := time.Now().Add(-time.Hour * time.Duration(currentConfig().OldDontRemoveTimeoutHours))
 	tooOldSnowflakeId := TimestampToSnowflakeId(tooOldTimeStamp)
 
 	return tooOldSnowflakeId
@@ -208,28 +345,50 @@ func excludeTooOldMessages(messagesAfterOutdate []*discordgo.Message) (filteredM
 	return filteredMessages
 }
 
-// Delete messages in channel with their threads
-func deleteChannelMessages(channelID string, messages []*discordgo.Message) (err error) {
-	// delete messages
+// Delete messages in channel. Their threads are queued for cleanup, a failed thread doesn't stop other ones.
+// Threads of messages deleted before an error are queued too. Returns number of queued threads
+func deleteChannelMessages(channelProperties *cpstorage.ChannelPropertiesEntity, messages []*discordgo.Message) (queuedThreadsNumber int, err error) {
 	messageIDs := make([]string, len(messages))
 	for i, message := range messages {
 		messageIDs[i] = message.ID
 	}
 
-	err = Session.ChannelMessagesBulkDelete(channelID, messageIDs)
-	if err != nil {
-		return err
+	deletedNumber, deleteErr := deleteMessagesByIDs(channelProperties.ChannelID, messageIDs)
+
+	queuedThreadsNumber, err = enqueueMessagesThreads(channelProperties, messages[:deletedNumber])
+	if deleteErr != nil {
+		return queuedThreadsNumber, deleteErr
 	}
+	return queuedThreadsNumber, err
+}
 
-	// delete threads
-	for _, message := range messages {
-		if message.Thread != nil {
-			_, err = Session.ChannelDelete(message.Thread.ID)
-			if err != nil {
-				return err
+// Delete messages by IDs. Bulk delete is used for several messages, single message is deleted by its own request.
+// Messages are deleted in order, returns number of messages deleted before an error
+func deleteMessagesByIDs(channelID string, messageIDs []string) (deletedNumber int, err error) {
+	for deletedNumber < len(messageIDs) {
+		chunk := messageIDs[deletedNumber:min(len(messageIDs), deletedNumber+maxBulkDeleteMessages)]
+
+		if len(chunk) < minBulkDeleteMessages {
+			err = Session.ChannelMessageDelete(channelID, chunk[0])
+			if isErrorMessageUnknown(err) {
+				// Message is already deleted
+				err = nil
 			}
+		} else {
+			err = Session.ChannelMessagesBulkDelete(channelID, chunk)
+		}
+		if err != nil {
+			return deletedNumber, err
 		}
+		deletedNumber += len(chunk)
 	}
+	return deletedNumber, nil
+}
 
-	return nil
+// Check if error is about message that doesn't exist
+func isErrorMessageUnknown(err error) (isUnknown bool) {
+	if errD, ok := err.(*discordgo.RESTError); ok && errD.Message != nil {
+		return errD.Message.Code == discordgo.ErrCodeUnknownMessage
+	}
+	return false
 }
@@ -0,0 +1,224 @@
+package main
+
+// In-memory schedule of channels checks. The remover sleeps until the nearest check instead of polling storage
+
+import (
+	"container/heap"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+const (
+	scheduleFallbackInterval = time.Minute      // Storage is checked at least so often. Catches changes made by other processes
+	failedPassRetryDelay     = 30 * time.Second // Delay before the next check of channel whose pass has failed
+)
+
+var (
+	removeSchedule = newChannelsSchedule()
+
+	// Date (unixtime) since which new messages are received by MessageCreate without gaps.
+	// Reset when a shard connects to the gateway again, events could be missed while it was disconnected
+	messageEventsSinceDateUnix atomic.Int64
+)
+
+// Check of channel for outdated messages
+type scheduledCheck struct {
+	channelID   string
+	dueDateUnix int64 // Date (unixtime) of the check
+	index       int   // Index in heap
+}
+
+// Heap of checks ordered by due date
+type checksHeap []*scheduledCheck
+
+func (checks checksHeap) Len() int           { return len(checks) }
+func (checks checksHeap) Less(i, j int) bool { return checks[i].dueDateUnix < checks[j].dueDateUnix }
+func (checks checksHeap) Swap(i, j int) {
+	checks[i], checks[j] = checks[j], checks[i]
+	checks[i].index = i
+	checks[j].index = j
+}
+
+func (checks *checksHeap) Push(x any) {
+	check := x.(*scheduledCheck)
+	check.index = len(*checks)
+	*checks = append(*checks, check)
+}
+
+func (checks *checksHeap) Pop() any {
+	old := *checks
+	check := old[len(old)-1]
+	old[len(old)-1] = nil
+	*checks = old[:len(old)-1]
+	return check
+}
+
+// Schedule of channels checks. At most one check per channel
+type channelsSchedule struct {
+	mutex    sync.Mutex
+	checks   checksHeap
+	channels map[string]*scheduledCheck // Channel ID -> its check
+	wakeup   chan struct{}              // Signals that the nearest check became earlier
+}
+
+func newChannelsSchedule() *channelsSchedule {
+	return &channelsSchedule{
+		channels: map[string]*scheduledCheck{},
+		wakeup:   make(chan struct{}, 1),
+	}
+}
+
+// Set date (unixtime) of the channel check
+func (schedule *channelsSchedule) set(channelID string, dueDateUnix int64) {
+	schedule.mutex.Lock()
+	defer schedule.mutex.Unlock()
+
+	schedule.setLocked(channelID, dueDateUnix)
+}
+
+// Make the channel to be checked not later than date (unixtime)
+func (schedule *channelsSchedule) setNotLater(channelID string, dueDateUnix int64) {
+	schedule.mutex.Lock()
+	defer schedule.mutex.Unlock()
+
+	if check, ok := schedule.channels[channelID]; ok && check.dueDateUnix <= dueDateUnix {
+		return
+	}
+	schedule.setLocked(channelID, dueDateUnix)
+}
+
+func (schedule *channelsSchedule) setLocked(channelID string, dueDateUnix int64) {
+	check, ok := schedule.channels[channelID]
+	if ok {
+		check.dueDateUnix = dueDateUnix
+		heap.Fix(&schedule.checks, check.index)
+	} else {
+		check = &scheduledCheck{channelID: channelID, dueDateUnix: dueDateUnix}
+		heap.Push(&schedule.checks, check)
+		schedule.channels[channelID] = check
+	}
+
+	// Remover may sleep until a later check
+	if schedule.checks[0] == check {
+		select {
+		case schedule.wakeup <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Remove check of the channel
+func (schedule *channelsSchedule) remove(channelID string) {
+	schedule.mutex.Lock()
+	defer schedule.mutex.Unlock()
+
+	if check, ok := schedule.channels[channelID]; ok {
+		heap.Remove(&schedule.checks, check.index)
+		delete(schedule.channels, channelID)
+	}
+}
+
+// Remove checks due at the date (unixtime) and get their channels. Checked channels must be scheduled again
+func (schedule *channelsSchedule) removeDue(momentUnix int64) (channelIDs []string) {
+	schedule.mutex.Lock()
+	defer schedule.mutex.Unlock()
+
+	for len(schedule.checks) > 0 && schedule.checks[0].dueDateUnix <= momentUnix {
+		check := heap.Pop(&schedule.checks).(*scheduledCheck)
+		delete(schedule.channels, check.channelID)
+		channelIDs = append(channelIDs, check.channelID)
+	}
+	return channelIDs
+}
+
+// Sleep until the nearest check is due, but not longer than maxWait
+func (schedule *channelsSchedule) wait(maxWait time.Duration) {
+	schedule.mutex.Lock()
+	waitDuration := maxWait
+	if len(schedule.checks) > 0 {
+		waitDuration = min(waitDuration, time.Until(time.Unix(schedule.checks[0].dueDateUnix, 0)))
+	}
+	schedule.mutex.Unlock()
+
+	if waitDuration <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(waitDuration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-schedule.wakeup:
+	}
+}
+
+// Schedule checks of all channels of this process from storage
+func loadRemoveSchedule() {
+	channelsProperties, err := cpstorage.GetAllChannelsProperties()
+	if err != nil {
+		log.Printf("Failed to load channels schedule: %v", err)
+		return
+	}
+
+	for _, channelProperties := range channelsProperties {
+		if !isOwnChannel(channelProperties) {
+			continue
+		}
+
+		// Paused channel is checked when its pause ends
+		if channelProperties.PausedUntilDateUnix == cpstorage.PausedIndefinitely {
+			continue
+		}
+		removeSchedule.set(channelProperties.ChannelID, max(channelProperties.NextRemoveDateUnix, channelProperties.PausedUntilDateUnix))
+	}
+}
+
+// Make the channel changed by command to be checked. Paused channel is checked when its pause ends
+func scheduleChangedChannel(channelID string, pausedUntilDateUnix int64) {
+	if pausedUntilDateUnix == cpstorage.PausedIndefinitely {
+		removeSchedule.remove(channelID)
+		return
+	}
+	removeSchedule.set(channelID, pausedUntilDateUnix)
+}
+
+// Triggered on every new message. Channel is scheduled to be checked when the message becomes outdated
+func MessageCreateHandler(session *discordgo.Session, event *discordgo.MessageCreate) {
+	channelID := event.ChannelID
+
+	channelProperties, err := cpstorage.GetChannelProperties(channelID)
+	if err != nil {
+		log.Printf("Failed to get channel %s: %v", channelID, err)
+		return
+	} else if channelProperties == nil {
+		// Messages are not deleted in channel
+		return
+	}
+
+	userTimeouts, err := cpstorage.GetChannelUserTimeouts(channelID)
+	if err != nil {
+		log.Printf("Failed to get user timeouts %s: %v", channelID, err)
+		return
+	}
+	lifetimes := newChannelLifetimes(channelProperties, userTimeouts)
+
+	// In precise mode the message is deleted by its own timer, the remover only catches what was missed
+	if channelProperties.IsPrecise {
+		expireDate := event.Timestamp.Add(time.Duration(lifetimes.messageTimeout(event.Message) * float64(time.Hour)))
+		scheduleExpiringMessage(event.Message, expireDate.Unix())
+		lifetimes = lifetimes.withDelay(preciseRemoverDelay)
+	}
+
+	removeDate := event.Timestamp.Add(time.Duration(lifetimes.messageTimeout(event.Message) * float64(time.Hour)))
+	err = cpstorage.ScheduleChannelMessage(channelID, event.Timestamp.Unix(), removeDate.Unix())
+	if err != nil {
+		log.Printf("Failed to schedule message removing in channel %s: %v", channelID, err)
+		return
+	}
+	removeSchedule.setNotLater(channelID, removeDate.Unix())
+}
@@ -0,0 +1,134 @@
+package main
+
+// Gateway sharding. Each guild is served by one shard, shards can be spread over several processes
+
+import (
+	"log"
+	"slices"
+	"strconv"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+var (
+	Sessions   []*discordgo.Session // Sessions of shards run by this process. Session is the first of them
+	shardCount = 1                  // Total number of shards of all processes
+	shardIDs   = []int{0}           // Shards run by this process
+
+	configShardIDs []int // Shards of this process from config. Empty - all shards, their number may be changed by Discord
+)
+
+// Create session for every shard of this process.
+// Shard count is requested from Discord if it is not set in config
+func loadSessions() {
+	config := currentConfig()
+
+	shardCount = config.ShardCount
+	if shardCount == 0 {
+		shardCount = getRecommendedShardCount(config.BotToken)
+	}
+
+	configShardIDs = config.ShardIDs
+	shardIDs = config.ShardIDs
+	if len(shardIDs) == 0 {
+		shardIDs = make([]int, shardCount)
+		for i := range shardIDs {
+			shardIDs[i] = i
+		}
+	}
+	for _, shardID := range shardIDs {
+		if shardID < 0 || shardID >= shardCount {
+			log.Fatalf("Shard %d is out of range of shard count %d", shardID, shardCount)
+		}
+	}
+
+	Sessions = nil
+	for _, shardID := range shardIDs {
+		session, err := discordgo.New(config.BotToken)
+		if err != nil {
+			log.Fatalf("Invalid bot parameters: %v", err)
+		}
+		session.ShardID = shardID
+		session.ShardCount = shardCount
+		Sessions = append(Sessions, session)
+	}
+	Session = Sessions[0]
+
+	log.Printf("Running shards %v of %d", shardIDs, shardCount)
+}
+
+// Get shard count recommended by Discord. One shard is used if it can't be received
+func getRecommendedShardCount(botToken string) int {
+	session, err := discordgo.New(botToken)
+	if err != nil {
+		log.Fatalf("Invalid bot parameters: %v", err)
+	}
+
+	gatewayBot, err := session.GatewayBot()
+	if err != nil {
+		log.Printf("Failed to get recommended shard count, using 1 shard: %v", err)
+		return 1
+	}
+	return max(gatewayBot.Shards, 1)
+}
+
+// Open gateway connections of all shards
+func openSessions() {
+	for _, session := range Sessions {
+		err := session.Open()
+		if err != nil {
+			log.Fatalf("Error when opening a bot session (shard %d): %v", session.ShardID, err)
+		}
+	}
+}
+
+// Close gateway connections of all shards
+func closeSessions() {
+	for _, session := range Sessions {
+		err := session.Close()
+		if err != nil {
+			log.Printf("Failed to close session (shard %d): %v", session.ShardID, err)
+		}
+	}
+}
+
+// Check if this process runs shard 0. Only it registers commands and resolves guilds of old channels,
+// so several processes don't do the same work
+func isMainShardProcess() bool {
+	return slices.Contains(shardIDs, 0)
+}
+
+// Get shard of the guild, as Discord calculates it
+func getGuildShardID(guildID string) (shardID int, err error) {
+	id, err := strconv.ParseUint(guildID, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int((id >> 22) % uint64(shardCount)), nil
+}
+
+// Check if the channel belongs to shards of this process.
+// Channels with unknown guild belong to the main process until their guild is resolved
+func isOwnChannel(channelProperties *cpstorage.ChannelPropertiesEntity) bool {
+	if channelProperties.GuildID == "" {
+		return isMainShardProcess()
+	}
+
+	shardID, err := getGuildShardID(channelProperties.GuildID)
+	if err != nil {
+		log.Printf("Invalid guild ID of channel %s: %v", channelProperties.ChannelID, err)
+		return false
+	}
+	return slices.Contains(shardIDs, shardID)
+}
+
+// Get filter of channels of this process shards for storage queries. nil if this process runs all shards
+func getOwnShardFilter() *cpstorage.ShardFilter {
+	for shardID := range shardCount {
+		if !slices.Contains(shardIDs, shardID) {
+			return &cpstorage.ShardFilter{Count: shardCount, IDs: shardIDs}
+		}
+	}
+	return nil
+}
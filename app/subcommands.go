@@ -0,0 +1,59 @@
+package main
+
+// Subcommands of the main binary. Run as "./main <subcommand> [args]"
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cfgloader"
+)
+
+var (
+	// Map of subcommands. Each subcommand returns process exit code
+	subcommands = map[string]func(args []string) (exitCode int){
+		"validate-config": validateConfigSubcommand,
+		"list":            listSubcommand,
+		"show":            showSubcommand,
+		"set":             setSubcommand,
+		"delete":          deleteSubcommand,
+		"pause":           pauseSubcommand,
+		"resume":          resumeSubcommand,
+		"export":          exportSubcommand,
+		"import":          importSubcommand,
+		"reschedule":      rescheduleSubcommand,
+		"vacuum":          vacuumSubcommand,
+		"backup":          backupSubcommand,
+	}
+)
+
+// Run subcommand by name
+func runSubcommand(name string, args []string) (exitCode int) {
+	subcommand, ok := subcommands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown subcommand %q\n", name)
+		return 2
+	}
+	return subcommand(args)
+}
+
+// Check config file and print all problems.
+// Usage: validate-config [path to config.ini]
+func validateConfigSubcommand(args []string) (exitCode int) {
+	configPath := SharedDataPath + "/config.ini"
+	if len(args) > 0 {
+		configPath = args[0]
+	}
+
+	_, warnings, err := cfgloader.LoadConfig(configPath)
+	for _, warning := range warnings {
+		fmt.Printf("warning: %s\n", warning)
+	}
+	if err != nil {
+		fmt.Printf("%s is invalid:\n%v\n", configPath, err)
+		return 1
+	}
+
+	fmt.Printf("%s is valid\n", configPath)
+	return 0
+}
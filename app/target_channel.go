@@ -0,0 +1,93 @@
+package main
+
+// Channel that timeout commands are applied to. Current channel or the one from "channel" option
+
+import (
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/i18n"
+)
+
+const (
+	// Permissions user needs in the target channel to read its timeout
+	viewTimeoutPermissions = int64(discordgo.PermissionViewChannel)
+	// Permissions user needs in the target channel to change its timeout
+	manageTimeoutPermissions = int64(discordgo.PermissionViewChannel | discordgo.PermissionManageMessages)
+	// Permissions bot needs in the target channel to delete messages
+	botRemovePermissions = int64(discordgo.PermissionViewChannel | discordgo.PermissionReadMessageHistory | discordgo.PermissionManageMessages)
+)
+
+// Create option to select the channel command is applied to
+func newTargetChannelOption() *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type: discordgo.ApplicationCommandOptionChannel,
+		Name: "channel",
+		ChannelTypes: []discordgo.ChannelType{
+			discordgo.ChannelTypeGuildText,
+			discordgo.ChannelTypeGuildNews,
+			discordgo.ChannelTypeGuildForum,
+			discordgo.ChannelTypeGuildVoice,
+		},
+	}
+}
+
+// Get ID of the channel command is applied to and check permissions of the user (and bot if botPermissions isn't 0) in it.
+// If channel can't be used, responds to the command with the reason and returns false
+func resolveTargetChannel(session *discordgo.Session, interaction *discordgo.InteractionCreate, userPermissions int64, botPermissions int64) (channelID string, isAllowed bool) {
+	channelID = interaction.ChannelID
+	if option, ok := getCommandOptions(interaction)["channel"]; ok {
+		channelID = option.ChannelValue(nil).ID
+	}
+
+	// Direct messages have no permissions
+	if interaction.Member == nil {
+		return channelID, true
+	}
+
+	memberPermissions, err := getChannelPermissions(session, interaction, interaction.Member.User.ID, channelID)
+	if err != nil {
+		log.Printf("Failed to get user permissions in channel %s: %v", channelID, err)
+		responseToCommand(i18n.T(getInteractionLocale(interaction), "error.check-permissions"), session, interaction)
+		return channelID, false
+	}
+	if !hasPermissions(memberPermissions, userPermissions) {
+		responseToCommand(i18n.T(getInteractionLocale(interaction), "permissions.user", channelID), session, interaction)
+		return channelID, false
+	}
+
+	if botPermissions == 0 {
+		return channelID, true
+	}
+
+	appPermissions, err := getChannelPermissions(session, interaction, session.State.User.ID, channelID)
+	if err != nil {
+		log.Printf("Failed to get bot permissions in channel %s: %v", channelID, err)
+		responseToCommand(i18n.T(getInteractionLocale(interaction), "error.check-permissions"), session, interaction)
+		return channelID, false
+	}
+	if !hasPermissions(appPermissions, botPermissions) {
+		responseToCommand(i18n.T(getInteractionLocale(interaction), "permissions.bot", channelID), session, interaction)
+		return channelID, false
+	}
+
+	return channelID, true
+}
+
+// Get permissions of the user (or bot) in the channel.
+// For the channel of interaction they are already computed by Discord
+func getChannelPermissions(session *discordgo.Session, interaction *discordgo.InteractionCreate, userID string, channelID string) (permissions int64, err error) {
+	if channelID == interaction.ChannelID {
+		if userID == session.State.User.ID {
+			return interaction.AppPermissions, nil
+		}
+		return interaction.Member.Permissions, nil
+	}
+
+	return session.UserChannelPermissions(userID, channelID)
+}
+
+// Check if permissions contain all required ones. Administrator has all permissions
+func hasPermissions(permissions int64, required int64) bool {
+	return permissions&discordgo.PermissionAdministrator != 0 || permissions&required == required
+}
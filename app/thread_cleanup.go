@@ -0,0 +1,209 @@
+package main
+
+// Cleanup of threads of deleted messages. Threads are queued and cleaned up one by one with retries,
+// so a failed thread doesn't stop deletion of messages and other threads
+
+import (
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+const (
+	threadCleanupMaxAttempts     = 8                  // Thread is left as is after so many failed attempts
+	threadCleanupRetryDelay      = 30 * time.Second   // Delay before the first retry. Doubled after every failed attempt
+	threadCleanupMaxRetryDelay   = time.Hour          // Maximum delay between attempts
+	threadCleanupsKeepDuration   = 7 * 24 * time.Hour // Outcomes of finished cleanups are kept so long
+	threadCleanupsForgetInterval = time.Hour          // Old outcomes are deleted so often
+)
+
+var (
+	threadCleanupSchedule = newChannelsSchedule()                  // Pending thread cleanups of this process by thread ID
+	threadCleanupsMetric  = expvar.NewMap("thread_cleanups_total") // Number of finished thread cleanups by status
+)
+
+// Clean up queued threads when their attempts are due
+func RunThreadCleanups() {
+	var reloadDate, forgetDate time.Time
+	for {
+		// Storage is the source of truth, threads could be queued by another process
+		if time.Now().After(reloadDate) {
+			loadThreadCleanupSchedule()
+			reloadDate = time.Now().Add(scheduleFallbackInterval)
+		}
+		if time.Now().After(forgetDate) {
+			forgetFinishedThreadCleanups()
+			forgetDate = time.Now().Add(threadCleanupsForgetInterval)
+		}
+
+		threadCleanupSchedule.wait(min(time.Until(reloadDate), time.Until(forgetDate)))
+
+		for _, threadID := range threadCleanupSchedule.removeDue(time.Now().Unix()) {
+			cleanupThread(threadID)
+		}
+	}
+}
+
+// Schedule pending thread cleanups of this process from storage
+func loadThreadCleanupSchedule() {
+	threadCleanups, err := cpstorage.GetPendingThreadCleanups()
+	if err != nil {
+		log.Printf("Failed to load thread cleanups schedule: %v", err)
+		return
+	}
+
+	for _, threadCleanup := range threadCleanups {
+		if isOwnThreadCleanup(threadCleanup) {
+			threadCleanupSchedule.setNotLater(threadCleanup.ThreadID, threadCleanup.NextAttemptDateUnix)
+		}
+	}
+}
+
+// Thread is cleaned up by process running shard of its guild
+func isOwnThreadCleanup(threadCleanup *cpstorage.ThreadCleanupEntity) bool {
+	return isOwnChannel(&cpstorage.ChannelPropertiesEntity{ChannelID: threadCleanup.ThreadID, GuildID: threadCleanup.GuildID})
+}
+
+// Delete outcomes of thread cleanups finished long ago
+func forgetFinishedThreadCleanups() {
+	_, err := cpstorage.DeleteFinishedThreadCleanups(time.Now().Add(-threadCleanupsKeepDuration).Unix())
+	if err != nil {
+		log.Printf("Failed to delete old thread cleanups: %v", err)
+	}
+}
+
+// Queue threads of deleted messages for cleanup. Returns number of queued threads
+func enqueueMessagesThreads(channelProperties *cpstorage.ChannelPropertiesEntity, messages []*discordgo.Message) (queuedThreadsNumber int, err error) {
+	nowUnix := time.Now().Unix()
+	var threadCleanups []*cpstorage.ThreadCleanupEntity
+	for _, message := range messages {
+		if message.Thread == nil {
+			continue
+		}
+
+		guildID := message.Thread.GuildID
+		if guildID == "" {
+			guildID = channelProperties.GuildID
+		}
+		threadCleanups = append(threadCleanups, &cpstorage.ThreadCleanupEntity{
+			ThreadID:            message.Thread.ID,
+			ChannelID:           channelProperties.ChannelID,
+			GuildID:             guildID,
+			IsArchive:           channelProperties.IsArchiveThreads,
+			NextAttemptDateUnix: nowUnix,
+			UpdatedDateUnix:     nowUnix,
+		})
+	}
+
+	err = cpstorage.EnqueueThreadCleanups(threadCleanups)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, threadCleanup := range threadCleanups {
+		if isOwnThreadCleanup(threadCleanup) {
+			threadCleanupSchedule.setNotLater(threadCleanup.ThreadID, nowUnix)
+		}
+	}
+	return len(threadCleanups), nil
+}
+
+// Make one attempt to clean up the thread and save its outcome
+func cleanupThread(threadID string) {
+	threadCleanup, err := cpstorage.GetThreadCleanup(threadID)
+	if err != nil {
+		log.Printf("Failed to get thread cleanup %s: %v", threadID, err)
+		threadCleanupSchedule.set(threadID, time.Now().Add(failedPassRetryDelay).Unix())
+		return
+	} else if threadCleanup == nil || threadCleanup.Status != cpstorage.ThreadCleanupPending {
+		// Thread was cleaned up by another process
+		return
+	}
+
+	status, err := deleteOrArchiveThread(threadCleanup)
+	if err != nil && isErrorChannelUnknown(err) {
+		status, err = cpstorage.ThreadCleanupGone, nil
+	}
+
+	threadCleanup.UpdatedDateUnix = time.Now().Unix()
+	if err != nil {
+		threadCleanup.Attempts++
+		threadCleanup.LastError = err.Error()
+		if threadCleanup.Attempts >= threadCleanupMaxAttempts {
+			threadCleanup.Status = cpstorage.ThreadCleanupFailed
+			log.Printf("Failed to clean up thread %s of channel %s after %d attempts: %v", threadID, threadCleanup.ChannelID, threadCleanup.Attempts, err)
+		} else {
+			retryDelay := min(threadCleanupRetryDelay<<(threadCleanup.Attempts-1), threadCleanupMaxRetryDelay)
+			threadCleanup.NextAttemptDateUnix = time.Now().Add(retryDelay).Unix()
+		}
+	} else {
+		threadCleanup.Status = status
+	}
+
+	err = cpstorage.UpdateThreadCleanup(threadCleanup)
+	if err != nil {
+		log.Printf("Failed to save thread cleanup %s: %v", threadID, err)
+		threadCleanupSchedule.set(threadID, time.Now().Add(failedPassRetryDelay).Unix())
+		return
+	}
+
+	if threadCleanup.Status == cpstorage.ThreadCleanupPending {
+		threadCleanupSchedule.set(threadID, threadCleanup.NextAttemptDateUnix)
+	} else {
+		threadCleanupsMetric.Add(threadCleanup.Status, 1)
+	}
+}
+
+// Delete the thread, or archive it if it has activity and the channel keeps such threads. Returns status of the cleanup
+func deleteOrArchiveThread(threadCleanup *cpstorage.ThreadCleanupEntity) (status string, err error) {
+	if threadCleanup.IsArchive {
+		thread, err := Session.Channel(threadCleanup.ThreadID)
+		if err != nil {
+			return "", err
+		}
+
+		channelProperties, err := cpstorage.GetChannelProperties(threadCleanup.ChannelID)
+		if err != nil {
+			return "", err
+		}
+
+		if isThreadActive(thread, channelProperties) {
+			if thread.ThreadMetadata == nil || !thread.ThreadMetadata.Archived {
+				archived := true
+				_, err = Session.ChannelEdit(thread.ID, &discordgo.ChannelEdit{Archived: &archived})
+				if err != nil {
+					return "", err
+				}
+			}
+			return cpstorage.ThreadCleanupArchived, nil
+		}
+	}
+
+	_, err = Session.ChannelDelete(threadCleanup.ThreadID)
+	if err != nil {
+		return "", err
+	}
+	return cpstorage.ThreadCleanupDeleted, nil
+}
+
+// Check if thread has messages that are not outdated yet.
+// If the channel has no timeout anymore, any message except the start one is activity
+func isThreadActive(thread *discordgo.Channel, channelProperties *cpstorage.ChannelPropertiesEntity) bool {
+	if thread.LastMessageID == "" || thread.LastMessageID == thread.ID {
+		return false
+	} else if channelProperties == nil {
+		return true
+	}
+	return thread.LastMessageID > getChannelOutdateTimeInSnowflakeIdFormat(channelProperties)
+}
+
+// Check if error is about channel (thread) that doesn't exist
+func isErrorChannelUnknown(err error) (isUnknown bool) {
+	if errD, ok := err.(*discordgo.RESTError); ok && errD.Message != nil {
+		return errD.Message.Code == discordgo.ErrCodeUnknownChannel
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package main
+
+// Per-user message lifetimes in channel
+
+import (
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/i18n"
+)
+
+// Message lifetimes in channel: channel timeout and timeouts of separate users
+type channelLifetimes struct {
+	channelTimeout float64            // Timeout (hours) of the channel
+	userTimeouts   map[string]float64 // User ID -> timeout (hours) of user messages
+}
+
+func newChannelLifetimes(channelProperties *cpstorage.ChannelPropertiesEntity, userTimeouts []*cpstorage.UserTimeoutEntity) channelLifetimes {
+	lifetimes := channelLifetimes{
+		channelTimeout: channelProperties.Timeout,
+		userTimeouts:   make(map[string]float64, len(userTimeouts)),
+	}
+	for _, userTimeout := range userTimeouts {
+		timeout := userTimeout.Timeout
+		if userTimeout.IsOwn {
+			// Channel timeout could be shortened after the user set own timeout
+			timeout = min(timeout, lifetimes.channelTimeout)
+		}
+		lifetimes.userTimeouts[userTimeout.UserID] = timeout
+	}
+	return lifetimes
+}
+
+// Get the shortest timeout in channel. Messages become outdated not earlier than after it
+func (lifetimes channelLifetimes) shortestTimeout() float64 {
+	shortestTimeout := lifetimes.channelTimeout
+	for _, timeout := range lifetimes.userTimeouts {
+		shortestTimeout = min(shortestTimeout, timeout)
+	}
+	return shortestTimeout
+}
+
+// Get the longest timeout in channel. Messages older than it are outdated by any lifetime
+func (lifetimes channelLifetimes) longestTimeout() float64 {
+	longestTimeout := lifetimes.channelTimeout
+	for _, timeout := range lifetimes.userTimeouts {
+		longestTimeout = max(longestTimeout, timeout)
+	}
+	return longestTimeout
+}
+
+// Get timeout of the message by its author
+func (lifetimes channelLifetimes) messageTimeout(message *discordgo.Message) float64 {
+	if message.Author != nil {
+		return lifetimes.userTimeout(message.Author.ID)
+	}
+	return lifetimes.channelTimeout
+}
+
+// Get timeout of messages of the user
+func (lifetimes channelLifetimes) userTimeout(userID string) float64 {
+	if timeout, ok := lifetimes.userTimeouts[userID]; ok {
+		return timeout
+	}
+	return lifetimes.channelTimeout
+}
+
+// Get lifetimes longer by delay
+func (lifetimes channelLifetimes) withDelay(delay time.Duration) channelLifetimes {
+	delayedLifetimes := channelLifetimes{
+		channelTimeout: lifetimes.channelTimeout + delay.Hours(),
+		userTimeouts:   make(map[string]float64, len(lifetimes.userTimeouts)),
+	}
+	for userID, timeout := range lifetimes.userTimeouts {
+		delayedLifetimes.userTimeouts[userID] = timeout + delay.Hours()
+	}
+	return delayedLifetimes
+}
+
+// Filter messages that are outdated by lifetime of their author
+func (lifetimes channelLifetimes) filterOutdatedMessages(messages []*discordgo.Message) (filteredMessages []*discordgo.Message) {
+	for _, message := range messages {
+		outdateTime := time.Now().Add(-time.Duration(lifetimes.messageTimeout(message) * float64(time.Hour)))
+		if message.Timestamp.Before(outdateTime) {
+			filteredMessages = append(filteredMessages, message)
+		}
+	}
+	return filteredMessages
+}
+
+// My timeout command handler. User sets shorter lifetime for own messages in the channel
+func MyTimeoutCommandHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	channelID := interaction.ChannelID
+	userID := getInteractionUserID(interaction)
+	locale := getInteractionLocale(interaction)
+
+	channelProperties, err := cpstorage.GetChannelProperties(channelID)
+	if err != nil {
+		log.Printf("Failed to get timeout: %v", err)
+		responseToCommand(i18n.T(locale, "error.save-timeout"), session, interaction)
+		return
+	} else if channelProperties == nil {
+		responseToCommand(i18n.T(locale, "timeout.not-set-here"), session, interaction)
+		return
+	}
+
+	hours, isSet, invalidMessage := getDurationOption(interaction, "duration")
+	if invalidMessage != "" {
+		responseToCommand(invalidMessage, session, interaction)
+		return
+	}
+
+	// Without duration user returns to the channel timeout
+	if !isSet {
+		err = cpstorage.DeleteUserTimeout(channelID, userID)
+		if err != nil {
+			log.Printf("Failed to delete user timeout: %v", err)
+			responseToCommand(i18n.T(locale, "error.save-timeout"), session, interaction)
+			return
+		}
+		writeInteractionAuditEntry(interaction, channelID, "reset")
+		responseToCommand(i18n.T(locale, "user-timeout.own-reset", сonvertFloatHoursToTimeString(channelProperties.Timeout)), session, interaction)
+		return
+	}
+
+	if hours >= channelProperties.Timeout {
+		responseToCommand(i18n.T(locale, "user-timeout.own-too-long", сonvertFloatHoursToTimeString(channelProperties.Timeout)), session, interaction)
+		return
+	}
+
+	writeUserTimeout(channelID, userID, hours, true, i18n.T(locale, "timeout.info-own", сonvertFloatHoursToTimeString(hours)), session, interaction)
+}
+
+// Set user timeout command handler. Moderator sets lifetime for messages of the user in the channel
+func SetUserTimeoutCommandHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	channelID, isAllowed := resolveTargetChannel(session, interaction, manageTimeoutPermissions, botRemovePermissions)
+	if !isAllowed {
+		return
+	}
+
+	locale := getInteractionLocale(interaction)
+	userID := getCommandOptions(interaction)["user"].UserValue(nil).ID
+
+	channelProperties, err := cpstorage.GetChannelProperties(channelID)
+	if err != nil {
+		log.Printf("Failed to get timeout: %v", err)
+		responseToCommand(i18n.T(locale, "error.save-timeout"), session, interaction)
+		return
+	} else if channelProperties == nil {
+		responseToCommand(i18n.T(locale, "user-timeout.no-channel-timeout", channelID), session, interaction)
+		return
+	}
+
+	hours, isSet, invalidMessage := getDurationOption(interaction, "duration")
+	if invalidMessage != "" {
+		responseToCommand(invalidMessage, session, interaction)
+		return
+	}
+
+	// Without duration user returns to the channel timeout
+	if !isSet {
+		err = cpstorage.DeleteUserTimeout(channelID, userID)
+		if err != nil {
+			log.Printf("Failed to delete user timeout: %v", err)
+			responseToCommand(i18n.T(locale, "error.save-timeout"), session, interaction)
+			return
+		}
+		writeInteractionAuditEntry(interaction, channelID, "user "+userID+" reset")
+		responseToCommand(i18n.T(locale, "user-timeout.reset", userID, channelID), session, interaction)
+		return
+	}
+
+	writeUserTimeout(channelID, userID, hours, false, i18n.T(locale, "user-timeout.set", userID, channelID, сonvertFloatHoursToTimeString(hours)), session, interaction)
+}
+
+// Save user timeout, check channel now and respond with the message. Own timeout is set by the user for own messages
+func writeUserTimeout(channelID string, userID string, hours float64, isOwn bool, responseMessage string, session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	err := cpstorage.WriteUserTimeout(&cpstorage.UserTimeoutEntity{
+		ChannelID: channelID,
+		UserID:    userID,
+		Timeout:   hours,
+		IsOwn:     isOwn,
+	})
+	if err == nil {
+		// Channel must be checked now, new timeout may be shorter than scheduled check
+		err = cpstorage.UpdateChannelNextRemoveDate(channelID, 0)
+	}
+	if err != nil {
+		log.Printf("Failed to save user timeout: %v", err)
+		responseToCommand(i18n.T(getInteractionLocale(interaction), "error.save-timeout"), session, interaction)
+		return
+	}
+	writeInteractionAuditEntry(interaction, channelID, "user "+userID+" timeout "+сonvertFloatHoursToTimeString(hours))
+
+	responseToCommand(responseMessage, session, interaction)
+}
+
+// Get ID of the user who sent the interaction. In guilds it is in Member, in direct messages - in User
+func getInteractionUserID(interaction *discordgo.InteractionCreate) string {
+	if interaction.Member != nil {
+		return interaction.Member.User.ID
+	}
+	return interaction.User.ID
+}
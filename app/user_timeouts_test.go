@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mdpakhmurin/discord-outdate-delete-bot/cpstorage"
+)
+
+// Own timeout is not longer than the channel timeout, timeout set by moderator can be longer
+func TestChannelLifetimesUserTimeout(t *testing.T) {
+	lifetimes := newChannelLifetimes(&cpstorage.ChannelPropertiesEntity{Timeout: 5}, []*cpstorage.UserTimeoutEntity{
+		{UserID: "own-shorter", Timeout: 2, IsOwn: true},
+		{UserID: "own-longer", Timeout: 8, IsOwn: true},
+		{UserID: "moderator-set", Timeout: 8},
+	})
+
+	tests := []struct {
+		userID  string
+		timeout float64
+	}{
+		{"own-shorter", 2},
+		{"own-longer", 5},
+		{"moderator-set", 8},
+		{"no-timeout", 5},
+	}
+	for _, test := range tests {
+		if timeout := lifetimes.userTimeout(test.userID); timeout != test.timeout {
+			t.Errorf("userTimeout(%s) = %v, want %v", test.userID, timeout, test.timeout)
+		}
+	}
+}
+
+func TestChannelLifetimesLongestTimeout(t *testing.T) {
+	lifetimes := newChannelLifetimes(&cpstorage.ChannelPropertiesEntity{Timeout: 5}, []*cpstorage.UserTimeoutEntity{
+		{UserID: "own-longer", Timeout: 8, IsOwn: true},
+		{UserID: "shorter", Timeout: 1},
+	})
+	if timeout := lifetimes.longestTimeout(); timeout != 5 {
+		t.Errorf("longestTimeout() = %v, want channel timeout 5", timeout)
+	}
+
+	lifetimes.userTimeouts["moderator-set"] = 7
+	if timeout := lifetimes.longestTimeout(); timeout != 7 {
+		t.Errorf("longestTimeout() with longer user timeout = %v, want 7", timeout)
+	}
+}